@@ -0,0 +1,275 @@
+package syslogsidecar
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Access control of the listener: sources of messages
+// (IP addresses of UDP packets and TCP/TLS connections) are checked before parsing
+type AccessConfiguration struct {
+	// Listener: transport ("tcp", "udp", "tls") or name of the listener
+	// (e.g. "udp/0.0.0.0:5141"). Empty - all listeners.
+	// Settings of the name are used before settings of the transport
+	LISTENER string
+
+	// Allowed sources - CIDRs or IP addresses, e.g. ["10.0.0.0/8", "192.168.1.10"].
+	// Empty - all sources except denied
+	ALLOW []string
+
+	// Denied sources - CIDRs or IP addresses, checked before ALLOW
+	DENY []string
+}
+
+// Returns settings for the listener, nil - without settings
+func accessConfOf(confs []AccessConfiguration, transport string, addr string) *AccessConfiguration {
+	var result *AccessConfiguration
+
+	rank := 0
+
+	for i := range confs {
+		if r := listenerRank(confs[i].LISTENER, transport, addr); r > rank {
+			rank = r
+			result = &confs[i]
+		}
+	}
+
+	return result
+}
+
+// Access control list of the listener
+type accessList struct {
+	listener string
+	allow    []netip.Prefix
+	deny     []netip.Prefix
+	rejects  *rejectLog
+}
+
+// Returns access list of the listener, nil - all sources are allowed
+func newAccessList(confs []AccessConfiguration, transport string, addr string, rejects *rejectLog) (*accessList, error) {
+	conf := accessConfOf(confs, transport, addr)
+	if (conf == nil) || (len(conf.ALLOW)+len(conf.DENY) == 0) {
+		return nil, nil
+	}
+
+	name := listenerName(transport, addr)
+
+	allow, err := parseCIDRs(conf.ALLOW)
+	if err != nil {
+		return nil, fmt.Errorf("wrong ALLOW of %s: %v", name, err)
+	}
+
+	deny, err := parseCIDRs(conf.DENY)
+	if err != nil {
+		return nil, fmt.Errorf("wrong DENY of %s: %v", name, err)
+	}
+
+	return &accessList{listener: name, allow: allow, deny: deny, rejects: rejects}, nil
+}
+
+// Returns false for denied source, rejected source is counted and logged.
+// Source without IP address is allowed
+func (al *accessList) permits(addr net.Addr) bool {
+	if al == nil {
+		return true
+	}
+
+	ip, ok := ipOf(addr)
+	if !ok {
+		return true
+	}
+
+	return al.permitsIP(ip)
+}
+
+func (al *accessList) permitsIP(ip netip.Addr) bool {
+	if al == nil {
+		return true
+	}
+
+	if !containsIP(al.deny, ip) && ((len(al.allow) == 0) || containsIP(al.allow, ip)) {
+		return true
+	}
+
+	mAccessRejected.inc(al.listener)
+	al.rejects.rejected(al.listener, ip.String())
+
+	return false
+}
+
+// Max number of sources in one record of the log
+const maxLoggedSources = 10
+
+// Max number of counted sources of the listener between records,
+// rejects of other sources are counted as rejects of "other"
+const maxTrackedSources = 1000
+
+const otherSources = "other"
+
+// Log of rejected sources: counts rejects and logs them not often than once per interval.
+// Counts are also logged by the timer and on stop
+type rejectLog struct {
+	interval time.Duration
+	now      func() time.Time
+	logf     func(format string, v ...any)
+
+	lock   sync.Mutex
+	next   time.Time
+	counts map[string]map[string]uint64 // listener -> source -> rejects
+
+	stopc chan struct{}
+	done  chan struct{}
+}
+
+// nil for interval <= 0 - rejected sources are not logged
+func newRejectLog(interval time.Duration) *rejectLog {
+	if interval <= 0 {
+		return nil
+	}
+
+	return &rejectLog{
+		interval: interval,
+		now:      time.Now,
+		logf:     log.Printf,
+		counts:   make(map[string]map[string]uint64),
+	}
+}
+
+func (rl *rejectLog) rejected(listener string, source string) {
+	if rl == nil {
+		return
+	}
+
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	sources, exists := rl.counts[listener]
+	if !exists {
+		sources = make(map[string]uint64)
+		rl.counts[listener] = sources
+	}
+
+	if _, exists = sources[source]; !exists && len(sources) >= maxTrackedSources {
+		source = otherSources
+	}
+	sources[source]++
+
+	rl.flushDue()
+}
+
+// Starts periodic logging of counts
+func (rl *rejectLog) start() {
+	if rl == nil || rl.stopc != nil {
+		return
+	}
+
+	rl.stopc = make(chan struct{})
+	rl.done = make(chan struct{})
+
+	go rl.run(rl.stopc, rl.done)
+}
+
+// Stops periodic logging and logs remaining counts
+func (rl *rejectLog) stop() {
+	if rl == nil {
+		return
+	}
+
+	if rl.stopc != nil {
+		close(rl.stopc)
+		<-rl.done
+		rl.stopc, rl.done = nil, nil
+	}
+
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	rl.flush()
+}
+
+func (rl *rejectLog) run(stopc chan struct{}, done chan struct{}) {
+	defer close(done)
+
+	ticker := time.NewTicker(rl.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopc:
+			return
+		case <-ticker.C:
+			rl.tick()
+		}
+	}
+}
+
+func (rl *rejectLog) tick() {
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	rl.flushDue()
+}
+
+// Logs counts if the interval since the previous record is over, called under lock
+func (rl *rejectLog) flushDue() {
+	if len(rl.counts) == 0 {
+		return
+	}
+
+	now := rl.now()
+	if now.Before(rl.next) {
+		return
+	}
+
+	rl.next = now.Add(rl.interval)
+	rl.flush()
+}
+
+// Logs one record per listener, e.g.
+// "syslogsidecar: udp/0.0.0.0:5141 rejected 10.1.1.1 (12), 10.1.1.2 (1)"
+func (rl *rejectLog) flush() {
+	listeners := make([]string, 0, len(rl.counts))
+	for listener := range rl.counts {
+		listeners = append(listeners, listener)
+	}
+	sort.Strings(listeners)
+
+	for _, listener := range listeners {
+		sources := rl.counts[listener]
+
+		ips := make([]string, 0, len(sources))
+		for ip := range sources {
+			ips = append(ips, ip)
+		}
+
+		// The most frequent first
+		sort.Slice(ips, func(i, j int) bool {
+			if sources[ips[i]] != sources[ips[j]] {
+				return sources[ips[i]] > sources[ips[j]]
+			}
+			return ips[i] < ips[j]
+		})
+
+		var sb strings.Builder
+		for i, ip := range ips {
+			if i == maxLoggedSources {
+				fmt.Fprintf(&sb, " and %d more", len(ips)-i)
+				break
+			}
+			if i > 0 {
+				sb.WriteString(", ")
+			}
+			fmt.Fprintf(&sb, "%s (%d)", ip, sources[ip])
+		}
+
+		rl.logf("syslogsidecar: %s rejected %s", listener, sb.String())
+	}
+
+	rl.counts = make(map[string]map[string]uint64)
+}
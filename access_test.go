@@ -0,0 +1,158 @@
+package syslogsidecar
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_AccessList(t *testing.T) {
+	confs := []AccessConfiguration{
+		{LISTENER: "", DENY: []string{"192.168.0.0/16"}},
+		{LISTENER: "udp", ALLOW: []string{"10.0.0.0/8", "2001:db8::/32"}, DENY: []string{"10.1.0.0/16"}},
+		{LISTENER: "udp/127.0.0.1:5141", ALLOW: []string{"127.0.0.1"}},
+	}
+
+	for _, tc := range []struct {
+		transport string
+		addr      string
+		ip        string
+		expected  bool
+	}{
+		{"tcp", "0.0.0.0:5141", "10.1.1.1", true},
+		{"tcp", "0.0.0.0:5141", "192.168.1.1", false},
+		{"udp", "0.0.0.0:5141", "10.2.1.1", true},
+		{"udp", "0.0.0.0:5141", "10.1.1.1", false},
+		{"udp", "0.0.0.0:5141", "172.16.0.1", false},
+		{"udp", "0.0.0.0:5141", "2001:db8::1", true},
+		{"udp", "0.0.0.0:5141", "::ffff:10.2.1.1", true},
+		{"udp", "127.0.0.1:5141", "127.0.0.1", true},
+		{"udp", "127.0.0.1:5141", "10.2.1.1", false},
+	} {
+		al, err := newAccessList(confs, tc.transport, tc.addr, nil)
+		if err != nil {
+			t.Fatalf("newAccessList error %v", err)
+		}
+
+		addr := &net.UDPAddr{IP: net.ParseIP(tc.ip), Port: 5141}
+
+		if actual := al.permits(addr); actual != tc.expected {
+			t.Errorf("%s %s: expected %v actual %v", listenerName(tc.transport, tc.addr), tc.ip, tc.expected, actual)
+		}
+	}
+
+	if al, _ := newAccessList(confs[1:], "tcp", "0.0.0.0:5141", nil); al != nil {
+		t.Errorf("listener without rules should not have access list")
+	}
+
+	if _, err := newAccessList([]AccessConfiguration{{ALLOW: []string{"10.0.0.0/33"}}}, "tcp", "0.0.0.0:5141", nil); err == nil {
+		t.Errorf("wrong CIDR should fail")
+	}
+
+	name := listenerName("udp", "0.0.0.0:5141")
+	rejected := mAccessRejected.value(name)
+
+	al, _ := newAccessList(confs, "udp", "0.0.0.0:5141", nil)
+	al.permitsIP(netip.MustParseAddr("172.16.0.1"))
+
+	if actual := mAccessRejected.value(name); actual != rejected+1 {
+		t.Errorf("expected %d rejects actual %d", rejected+1, actual)
+	}
+}
+
+func Test_RejectLog(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var records []string
+
+	rl := newRejectLog(time.Minute)
+	rl.now = func() time.Time { return now }
+	rl.logf = func(format string, v ...any) { records = append(records, fmt.Sprintf(format, v...)) }
+
+	rl.rejected("udp/0.0.0.0:5141", "10.0.0.1")
+	rl.rejected("udp/0.0.0.0:5141", "10.0.0.2")
+	rl.rejected("udp/0.0.0.0:5141", "10.0.0.2")
+
+	now = now.Add(30 * time.Second)
+	for i := 0; i < 12; i++ {
+		rl.rejected("tcp/0.0.0.0:5141", fmt.Sprintf("10.0.1.%d", i))
+	}
+
+	if len(records) != 1 || records[0] != "syslogsidecar: udp/0.0.0.0:5141 rejected 10.0.0.1 (1)" {
+		t.Fatalf("wrong records %q", records)
+	}
+
+	now = now.Add(30 * time.Second)
+	rl.rejected("tcp/0.0.0.0:5141", "10.0.1.0")
+
+	if len(records) != 3 {
+		t.Fatalf("wrong records %q", records)
+	}
+
+	if !strings.HasPrefix(records[1], "syslogsidecar: tcp/0.0.0.0:5141 rejected 10.0.1.0 (2), 10.0.1.1 (1)") ||
+		!strings.HasSuffix(records[1], " and 2 more") {
+		t.Errorf("wrong record %q", records[1])
+	}
+
+	if records[2] != "syslogsidecar: udp/0.0.0.0:5141 rejected 10.0.0.2 (2)" {
+		t.Errorf("wrong record %q", records[2])
+	}
+
+	if newRejectLog(0) != nil {
+		t.Errorf("reject log without interval should be nil")
+	}
+}
+
+// The last rejects are logged by the timer and on stop, number of counted sources is limited
+func Test_RejectLogFlush(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	var records []string
+
+	rl := newRejectLog(time.Minute)
+	rl.now = func() time.Time { return now }
+	rl.logf = func(format string, v ...any) { records = append(records, fmt.Sprintf(format, v...)) }
+
+	rl.rejected("udp/0.0.0.0:5141", "10.0.0.1")
+	rl.rejected("udp/0.0.0.0:5141", "10.0.0.2")
+
+	rl.tick()
+	if len(records) != 1 {
+		t.Fatalf("wrong records %q", records)
+	}
+
+	now = now.Add(time.Minute)
+	rl.tick()
+	if len(records) != 2 || records[1] != "syslogsidecar: udp/0.0.0.0:5141 rejected 10.0.0.2 (1)" {
+		t.Fatalf("last rejects were not logged by timer %q", records)
+	}
+
+	rl.tick()
+	if len(records) != 2 {
+		t.Fatalf("timer without rejects %q", records)
+	}
+
+	for i := 0; i < maxTrackedSources+5; i++ {
+		rl.rejected("udp/0.0.0.0:5141", fmt.Sprintf("10.1.%d.%d", i/256, i%256))
+	}
+	rl.rejected("udp/0.0.0.0:5141", "10.1.0.0")
+
+	if n := len(rl.counts["udp/0.0.0.0:5141"]); n != maxTrackedSources+1 {
+		t.Errorf("expected %d counted sources actual %d", maxTrackedSources+1, n)
+	}
+
+	rl.start()
+	rl.stop()
+
+	if len(records) != 3 ||
+		!strings.HasPrefix(records[2], "syslogsidecar: udp/0.0.0.0:5141 rejected other (5), 10.1.0.0 (2), ") {
+		t.Fatalf("last rejects were not logged on stop %q", records)
+	}
+
+	if len(rl.counts) != 0 {
+		t.Errorf("counts were not reset")
+	}
+}
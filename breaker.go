@@ -0,0 +1,156 @@
+package syslogsidecar
+
+import (
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+func (st breakerState) String() string {
+	switch st {
+	case breakerClosed:
+		return "closed"
+	case breakerOpen:
+		return "open"
+	case breakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// Circuit breaker around Produce:
+//   - closed: messages are produced, consecutive failures are counted
+//   - open: after 'threshold' consecutive failures, messages aren't produced
+//     during 'openTime'
+//   - half-open: after 'openTime' one probe message is produced,
+//     success closes the breaker, failure opens it again
+type circuitBreaker struct {
+	lock      sync.Mutex
+	threshold int
+	openTime  time.Duration
+	state     breakerState
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	now       func() time.Time
+}
+
+// Returns nil for threshold <= 0 - breaker is not used.
+// All methods of nil breaker are valid
+func newCircuitBreaker(threshold int, openTime time.Duration) *circuitBreaker {
+	if threshold <= 0 {
+		return nil
+	}
+
+	if openTime <= 0 {
+		openTime = time.Second
+	}
+
+	cb := new(circuitBreaker)
+	cb.threshold = threshold
+	cb.openTime = openTime
+	cb.now = time.Now
+	return cb
+}
+
+// Returns true if message may be produced
+func (cb *circuitBreaker) allow() bool {
+	if cb == nil {
+		return true
+	}
+
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	switch cb.state {
+	case breakerClosed:
+		return true
+	case breakerOpen:
+		if cb.now().Sub(cb.openedAt) < cb.openTime {
+			return false
+		}
+		cb.state = breakerHalfOpen
+		cb.probing = true
+		return true
+	case breakerHalfOpen:
+		if cb.probing {
+			return false
+		}
+		cb.probing = true
+		return true
+	}
+
+	return true
+}
+
+func (cb *circuitBreaker) success() {
+	if cb == nil {
+		return
+	}
+
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	cb.state = breakerClosed
+	cb.failures = 0
+	cb.probing = false
+}
+
+func (cb *circuitBreaker) failure() {
+	if cb == nil {
+		return
+	}
+
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	cb.probing = false
+
+	if cb.state == breakerHalfOpen {
+		cb.trip()
+		return
+	}
+
+	cb.failures++
+
+	if cb.failures >= cb.threshold {
+		cb.trip()
+	}
+}
+
+// Result of the probe is unknown, e.g. message was not produced,
+// allows the next probe
+func (cb *circuitBreaker) release() {
+	if cb == nil {
+		return
+	}
+
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	cb.probing = false
+}
+
+func (cb *circuitBreaker) current() breakerState {
+	if cb == nil {
+		return breakerClosed
+	}
+
+	cb.lock.Lock()
+	defer cb.lock.Unlock()
+
+	return cb.state
+}
+
+func (cb *circuitBreaker) trip() {
+	cb.state = breakerOpen
+	cb.failures = 0
+	cb.openedAt = cb.now()
+}
@@ -0,0 +1,68 @@
+package syslogsidecar
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_BreakerDisabled(t *testing.T) {
+	cb := newCircuitBreaker(0, time.Second)
+
+	for i := 0; i < 10; i++ {
+		cb.failure()
+	}
+
+	if !cb.allow() {
+		t.Errorf("disabled breaker should allow produce")
+	}
+}
+
+func Test_BreakerTripProbe(t *testing.T) {
+	now := time.Now()
+
+	cb := newCircuitBreaker(3, time.Second)
+	cb.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		if !cb.allow() {
+			t.Fatalf("closed breaker should allow produce")
+		}
+		cb.failure()
+	}
+
+	if cb.current() != breakerOpen {
+		t.Fatalf("expected %s actual %s", breakerOpen, cb.current())
+	}
+
+	if cb.allow() {
+		t.Fatalf("open breaker should not allow produce")
+	}
+
+	now = now.Add(time.Second)
+
+	if !cb.allow() {
+		t.Fatalf("expected probe after open time")
+	}
+
+	if cb.allow() {
+		t.Fatalf("only one probe is allowed")
+	}
+
+	cb.failure()
+
+	if cb.current() != breakerOpen {
+		t.Fatalf("failed probe should open breaker")
+	}
+
+	now = now.Add(time.Second)
+
+	if !cb.allow() {
+		t.Fatalf("expected probe after open time")
+	}
+
+	cb.success()
+
+	if cb.current() != breakerClosed {
+		t.Errorf("successful probe should close breaker")
+	}
+}
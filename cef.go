@@ -0,0 +1,169 @@
+package syslogsidecar
+
+import (
+	"strings"
+
+	"github.com/g41797/sputnik"
+)
+
+// Name of CEF parsing processor and its configuration (cef.json)
+const CEFName = "cef"
+
+// Configuration of CEF (ArcSight Common Event Format) parsing processor
+// is stored in cef.json. The file is optional
+type CEFConfiguration struct {
+	// Prefix of names of parsed parts (default "cef.")
+	PREFIX string
+}
+
+// Names of CEF header fields (without prefix)
+var cefHeader = [...]string{
+	"version",
+	"device_vendor",
+	"device_product",
+	"device_version",
+	"signature_id",
+	"name",
+	"severity",
+}
+
+type cefParser struct {
+	conf CEFConfiguration
+}
+
+func newCEFParser() Processor {
+	return new(cefParser)
+}
+
+func init() {
+	RegisterProcessorFactory(CEFName, newCEFParser)
+}
+
+func (cp *cefParser) Init(cf sputnik.ConfFactory) error {
+	if err := readProcessorConfiguration(cf, CEFName, &cp.conf); err != nil {
+		return err
+	}
+
+	if len(cp.conf.PREFIX) == 0 {
+		cp.conf.PREFIX = "cef."
+	}
+
+	return nil
+}
+
+// Parses CEF payload of "message" (RFC5424), "content" (RFC3164) or "data"
+// and adds header fields and extensions as parts, e.g. "cef.device_vendor", "cef.src"
+func (cp *cefParser) Process(msg sputnik.Msg) []sputnik.Msg {
+	parts, err := UnpackToMap(msg)
+	if err != nil {
+		return []sputnik.Msg{msg}
+	}
+
+	payload, found := markedPayload(parts, "CEF:")
+	if !found {
+		return []sputnik.Msg{msg}
+	}
+
+	header, extension, ok := parseCEF(payload)
+	if !ok {
+		mParsed.inc(CEFName, parseFailed)
+		return []sputnik.Msg{msg}
+	}
+
+	for i, name := range cefHeader {
+		parts[cp.conf.PREFIX+name] = header[i]
+	}
+
+	for _, kv := range extension {
+		parts[cp.conf.PREFIX+kv[0]] = kv[1]
+	}
+
+	if err = Pack(msg, parts); err != nil {
+		mParsed.inc(CEFName, parseFailed)
+		return []sputnik.Msg{msg}
+	}
+
+	mParsed.inc(CEFName, parseParsed)
+
+	return []sputnik.Msg{msg}
+}
+
+// Parses "CEF:Version|Device Vendor|Device Product|Device Version|Signature ID|Name|Severity|Extension"
+// https://www.microfocus.com/documentation/arcsight/arcsight-smartconnectors/pdfdoc/common-event-format-v25/common-event-format-v25.pdf
+func parseCEF(payload string) (header []string, extension [][2]string, ok bool) {
+	payload = strings.TrimPrefix(payload, "CEF:")
+
+	start := 0
+
+	for i := 0; i < len(payload) && len(header) < len(cefHeader); i++ {
+		switch payload[i] {
+		case '\\':
+			i++
+		case '|':
+			header = append(header, unescapeBackslash(payload[start:i]))
+			start = i + 1
+		}
+	}
+
+	if len(header) != len(cefHeader) {
+		return nil, nil, false
+	}
+
+	return header, parseCEFExtension(payload[start:]), true
+}
+
+// Parses space separated key=value pairs. Values may contain spaces,
+// '=' and '\' within values are escaped by '\'
+func parseCEFExtension(ext string) [][2]string {
+	type keyPos struct {
+		start int // start of the key
+		eq    int // position of '='
+	}
+
+	var keys []keyPos
+
+	for i := 0; i < len(ext); i++ {
+		switch ext[i] {
+		case '\\':
+			i++
+		case '=':
+			start := strings.LastIndexByte(ext[:i], ' ') + 1
+			if isCEFKey(ext[start:i]) {
+				keys = append(keys, keyPos{start, i})
+			}
+		}
+	}
+
+	result := make([][2]string, 0, len(keys))
+
+	for i, key := range keys {
+		end := len(ext)
+		if i < len(keys)-1 {
+			end = keys[i+1].start
+		}
+
+		value := strings.TrimRight(ext[key.eq+1:end], " ")
+		result = append(result, [2]string{ext[key.start:key.eq], unescapeBackslash(value)})
+	}
+
+	return result
+}
+
+func isCEFKey(key string) bool {
+	if len(key) == 0 {
+		return false
+	}
+
+	for _, c := range key {
+		switch {
+		case c >= 'a' && c <= 'z':
+		case c >= 'A' && c <= 'Z':
+		case c >= '0' && c <= '9':
+		case c == '_', c == '.', c == '-', c == '[', c == ']':
+		default:
+			return false
+		}
+	}
+
+	return true
+}
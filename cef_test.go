@@ -0,0 +1,106 @@
+package syslogsidecar
+
+import (
+	"testing"
+)
+
+func Test_CEF(t *testing.T) {
+	prc := newCEFParser()
+	if err := prc.Init(testConfFactory(CEFName, CEFConfiguration{})); err != nil {
+		t.Fatalf("Init error %v", err)
+	}
+
+	parts := makeRFC5424Msg()
+	parts["message"] = `CEF:0|Security|threat\|manager|1.0|100|worm successfully stopped|10|` +
+		`src=10.0.0.1 dst=2.1.2.2 spt=1232 msg=Detected a threat. a\=b path\\ok request=http://x/?q=1`
+
+	before := mParsed.value(CEFName, parseParsed)
+
+	result := processParts(t, prc, parts)
+
+	expected := map[string]string{
+		"cef.version":        "0",
+		"cef.device_vendor":  "Security",
+		"cef.device_product": "threat|manager",
+		"cef.device_version": "1.0",
+		"cef.signature_id":   "100",
+		"cef.name":           "worm successfully stopped",
+		"cef.severity":       "10",
+		"cef.src":            "10.0.0.1",
+		"cef.dst":            "2.1.2.2",
+		"cef.spt":            "1232",
+		"cef.msg":            `Detected a threat. a=b path\ok`,
+		"cef.request":        "http://x/?q=1",
+	}
+
+	for name, val := range expected {
+		if result[name] != val {
+			t.Errorf("part %s: expected %q actual %q", name, val, result[name])
+		}
+	}
+
+	if result["message"] != parts["message"] {
+		t.Errorf("raw message was changed")
+	}
+
+	if mParsed.value(CEFName, parseParsed) != before+1 {
+		t.Errorf("parsing was not counted")
+	}
+
+	// RFC3164: "CEF" parsed as tag
+	parts = makeRFC3164Msg()
+	parts[rfc3164OnlyKey] = "CEF"
+	parts["content"] = "0|Vendor|Product|2|login|User login|3|suser=admin"
+
+	result = processParts(t, prc, parts)
+
+	if result["cef.device_product"] != "Product" || result["cef.suser"] != "admin" {
+		t.Errorf("wrong parsing of RFC3164 message %v", result)
+	}
+
+	// Not CEF and malformed CEF
+	for _, text := range []string{"regular CEF: message", "CEF:0|Vendor|Product"} {
+		parts = makeRFC5424Msg()
+		parts["message"] = text
+
+		result = processParts(t, prc, parts)
+
+		if _, exists := result["cef.version"]; exists {
+			t.Errorf("%s should not be parsed", text)
+		}
+	}
+}
+
+func Test_MarkedPayload(t *testing.T) {
+	const cef = "CEF:0|Vendor|Product|2|login|User login|3|suser=admin"
+
+	for _, tc := range []struct {
+		part     string
+		text     string
+		expected bool
+	}{
+		{"message", cef, true},
+		{"message", "user typed " + cef, false},
+		{"content", "forwarded " + cef, false},
+		{Formermessage, cef, true},
+		{Formermessage, "<134>1 2003-10-11T22:14:15.003Z host app - - - " + cef, true},
+		{Formermessage, `<134>1 2003-10-11T22:14:15.003Z host app - - [id a="b c"] ` + cef, true},
+		{Formermessage, "<134>Oct 11 22:14:15 host " + cef, true},
+		{Formermessage, "<134>Oct  1 22:14:15 host app: " + cef, true},
+		{Formermessage, "<134>Oct 11 22:14:15 host app: user typed " + cef, false},
+		{Formermessage, "garbage " + cef, false},
+	} {
+		parts := map[string]string{tc.part: tc.text}
+		switch tc.part {
+		case "message":
+			parts[rfcFormatKey] = rfc5424
+		case "content":
+			parts[rfcFormatKey] = rfc3164
+		}
+
+		payload, found := markedPayload(parts, "CEF:")
+		if found != tc.expected || (found && payload != cef) {
+			t.Errorf("%q: expected %v actual %v %q", tc.text, tc.expected, found, payload)
+		}
+	}
+}
@@ -0,0 +1,238 @@
+package syslogsidecar
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Reasons of rejecting of connections
+const (
+	rejectedTotalLimit = "limit"
+	rejectedIPLimit    = "ip_limit"
+)
+
+// Default max size of received message, the same as bufio.Scanner
+const defaultMaxMessageSize = bufio.MaxScanTokenSize
+
+// Default marker of truncated message
+const defaultTruncationMarker = "...[truncated]"
+
+// Limits of the number of connections of all TCP and TLS listeners
+type connLimits struct {
+	maxTotal int
+	maxPerIP int
+
+	lock  sync.Mutex
+	total int
+	perIP map[string]int
+}
+
+// 0 - without limit
+func newConnLimits(maxTotal int, maxPerIP int) *connLimits {
+	return &connLimits{maxTotal: maxTotal, maxPerIP: maxPerIP, perIP: make(map[string]int)}
+}
+
+// Registers connection from ip, returns reason of rejecting if a limit is reached
+func (cl *connLimits) acquire(ip string) (string, bool) {
+	if cl == nil {
+		return "", true
+	}
+
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+
+	if (cl.maxTotal > 0) && (cl.total >= cl.maxTotal) {
+		return rejectedTotalLimit, false
+	}
+
+	if (cl.maxPerIP > 0) && (cl.perIP[ip] >= cl.maxPerIP) {
+		return rejectedIPLimit, false
+	}
+
+	cl.total++
+	cl.perIP[ip]++
+
+	return "", true
+}
+
+func (cl *connLimits) release(ip string) {
+	if cl == nil {
+		return
+	}
+
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+
+	cl.total--
+
+	if cl.perIP[ip]--; cl.perIP[ip] <= 0 {
+		delete(cl.perIP, ip)
+	}
+}
+
+// Counters of the connection
+type connStats struct {
+	listener string
+	client   string
+	since    time.Time
+
+	messages    atomic.Uint64
+	bytes       atomic.Uint64
+	parseErrors atomic.Uint64
+	truncated   atomic.Uint64
+}
+
+// Serialized statistics of the connection (/connections endpoint)
+type connReport struct {
+	Listener    string    `json:"listener"`
+	Client      string    `json:"client"`
+	Since       time.Time `json:"since"`
+	Messages    uint64    `json:"messages"`
+	Bytes       uint64    `json:"bytes"`
+	ParseErrors uint64    `json:"parse_errors"`
+	Truncated   uint64    `json:"truncated"`
+}
+
+func (cs *connStats) report() connReport {
+	return connReport{
+		Listener:    cs.listener,
+		Client:      cs.client,
+		Since:       cs.since,
+		Messages:    cs.messages.Load(),
+		Bytes:       cs.bytes.Load(),
+		ParseErrors: cs.parseErrors.Load(),
+		Truncated:   cs.truncated.Load(),
+	}
+}
+
+// Serves /connections: statistics of open TCP and TLS connections
+func connectionsHandler(streams func() []*streamServer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reports := make([]connReport, 0)
+
+		for _, ss := range streams() {
+			reports = append(reports, ss.reports()...)
+		}
+
+		sort.Slice(reports, func(i, j int) bool {
+			if reports[i].Listener != reports[j].Listener {
+				return reports[i].Listener < reports[j].Listener
+			}
+			return reports[i].Since.Before(reports[j].Since)
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(reports)
+	})
+}
+
+// Split function for messages with limited size.
+// Longer message is truncated, the marker is appended to truncated part,
+// the rest of the message is skipped:
+//   - for octet counting (RFC6587) - according to the count
+//   - otherwise till the end of the line (LF or other byte of ends)
+type limitedSplit struct {
+	split     bufio.SplitFunc
+	ends      string
+	max       int
+	marker    []byte
+	truncated func()
+
+	skipBytes int  // octet counting
+	skipLine  bool // non-transparent framing
+}
+
+func newLimitedSplit(split bufio.SplitFunc, max int, marker string, truncated func()) *limitedSplit {
+	if split == nil {
+		split = bufio.ScanLines
+	}
+	return &limitedSplit{split: split, ends: "\n", max: max, marker: []byte(marker), truncated: truncated}
+}
+
+func (ls *limitedSplit) scan(data []byte, atEOF bool) (int, []byte, error) {
+	if ls.skipBytes > 0 {
+		skipped := ls.skipBytes
+		if skipped > len(data) {
+			skipped = len(data)
+		}
+		ls.skipBytes -= skipped
+		return skipped, nil, nil
+	}
+
+	if ls.skipLine {
+		if i := bytes.IndexAny(data, ls.ends); i >= 0 {
+			ls.skipLine = false
+			return i + 1, nil, nil
+		}
+		return len(data), nil, nil
+	}
+
+	advance, token, err := ls.split(data, atEOF)
+
+	if (err != nil) || (advance > 0) || (token != nil) {
+		if len(token) > ls.max {
+			token = ls.truncate(token)
+		}
+		return advance, token, err
+	}
+
+	if len(data) < ls.max {
+		return 0, nil, nil
+	}
+
+	// Message is longer than the limit
+	if prefix, count, ok := octetCount(data); ok {
+		if end := prefix + count; end < len(data) {
+			return end, ls.truncate(data[prefix:end]), nil
+		}
+		ls.skipBytes = prefix + count - len(data)
+		return len(data), ls.truncate(data[prefix:]), nil
+	}
+
+	ls.skipLine = true
+
+	return len(data), ls.truncate(data), nil
+}
+
+func (ls *limitedSplit) truncate(msg []byte) []byte {
+	if ls.truncated != nil {
+		ls.truncated()
+	}
+
+	return truncateMessage(msg, ls.max, ls.marker)
+}
+
+// Returns copy of first max bytes of the message with the marker
+func truncateMessage(msg []byte, max int, marker []byte) []byte {
+	if len(msg) > max {
+		msg = msg[:max]
+	}
+
+	result := make([]byte, 0, len(msg)+len(marker))
+	result = append(result, msg...)
+	result = append(result, marker...)
+
+	return result
+}
+
+// Returns length of octet counting prefix ("123 ") and the count of RFC6587 message
+func octetCount(data []byte) (int, int, bool) {
+	space := bytes.IndexByte(data, ' ')
+	if space <= 0 || space > 10 {
+		return 0, 0, false
+	}
+
+	count, err := strconv.Atoi(string(data[:space]))
+	if err != nil || count <= 0 {
+		return 0, 0, false
+	}
+
+	return space + 1, count, true
+}
@@ -0,0 +1,145 @@
+package syslogsidecar
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/g41797/go-syslog"
+)
+
+func scanAll(split *limitedSplit, input string) []string {
+	scanner := bufio.NewScanner(strings.NewReader(input))
+	scanner.Split(split.scan)
+	scanner.Buffer(make([]byte, 0, split.max), split.max)
+
+	var result []string
+	for scanner.Scan() {
+		result = append(result, scanner.Text())
+	}
+	return result
+}
+
+func Test_LimitedSplit(t *testing.T) {
+	truncated := 0
+
+	split := newLimitedSplit(nil, 10, "~", func() { truncated++ })
+
+	tokens := scanAll(split, "short\n0123456789abcdef\nnext\n")
+	if strings.Join(tokens, "|") != "short|0123456789~|next" || truncated != 1 {
+		t.Errorf("wrong tokens %q truncated %d", tokens, truncated)
+	}
+
+	// RFC6587 octet counting
+	long := "<34>1 - host app - - - " + strings.Repeat("x", 40)
+	short := "<34>1 - host app - - - y"
+
+	split = newLimitedSplit(syslog.Automatic.GetSplitFunc(), 40, "~", nil)
+
+	tokens = scanAll(split, strconv.Itoa(len(long))+" "+long+strconv.Itoa(len(short))+" "+short)
+	if len(tokens) != 2 || tokens[0] != long[:37]+"~" || tokens[1] != short {
+		t.Errorf("wrong tokens %q", tokens)
+	}
+}
+
+func Test_ConnectionLimits(t *testing.T) {
+	limits := newConnLimits(3, 2)
+
+	for i, tc := range []struct {
+		ip     string
+		reason string
+	}{
+		{"10.0.0.1", ""},
+		{"10.0.0.1", ""},
+		{"10.0.0.1", rejectedIPLimit},
+		{"10.0.0.2", ""},
+		{"10.0.0.3", rejectedTotalLimit},
+	} {
+		if reason, ok := limits.acquire(tc.ip); reason != tc.reason || ok != (len(tc.reason) == 0) {
+			t.Errorf("%d %s: expected %q actual %q", i, tc.ip, tc.reason, reason)
+		}
+	}
+
+	limits.release("10.0.0.1")
+
+	if _, ok := limits.acquire("10.0.0.3"); !ok {
+		t.Errorf("released connection should be reused")
+	}
+
+	received := make(logPartsChannel, 1)
+
+	name := listenerName("tcp", "127.0.0.1:5181")
+	form, _ := formatOfListener(nil, "tcp", "127.0.0.1:5181", false)
+
+	ss := newStreamServer(name, form, received)
+	ss.setLimits(newConnLimits(0, 1), 300*time.Millisecond)
+
+	if err := ss.Listen("tcp", "127.0.0.1:5181"); err != nil {
+		t.Fatalf("Listen error %v", err)
+	}
+
+	ss.Boot()
+	defer ss.Wait()
+	defer ss.Kill()
+
+	first, err := net.Dial("tcp", "127.0.0.1:5181")
+	if err != nil {
+		t.Fatalf("Dial error %v", err)
+	}
+	defer first.Close()
+
+	first.Write([]byte("<34>1 2003-10-11T22:14:15.003Z mymachine su - ID47 - first\n<34>1 bad\n"))
+	<-received
+	<-received
+
+	// Parse error is counted after handling
+	reports := ss.reports()
+	for i := 0; (i < 100) && (len(reports) == 1) && (reports[0].ParseErrors == 0); i++ {
+		time.Sleep(10 * time.Millisecond)
+		reports = ss.reports()
+	}
+
+	if len(reports) != 1 || reports[0].Messages != 2 || reports[0].ParseErrors != 1 || reports[0].Listener != name {
+		t.Errorf("wrong statistics %v", reports)
+	}
+
+	rejected := mConnectionsRejected.value(name, rejectedIPLimit)
+
+	second, err := net.Dial("tcp", "127.0.0.1:5181")
+	if err != nil {
+		t.Fatalf("Dial error %v", err)
+	}
+	defer second.Close()
+
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = second.Read(make([]byte, 1)); err == nil {
+		t.Errorf("connection above the limit should be closed")
+	}
+
+	if actual := mConnectionsRejected.value(name, rejectedIPLimit); actual != rejected+1 {
+		t.Errorf("expected %d rejected connections actual %d", rejected+1, actual)
+	}
+
+	// Idle timeout
+	idle := mConnectionsIdleClosed.value(name)
+
+	first.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, err = first.Read(make([]byte, 1)); err == nil {
+		t.Errorf("idle connection should be closed")
+	}
+
+	for i := 0; (i < 100) && (ss.connections() > 0); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if connections := ss.connections(); connections != 0 {
+		t.Errorf("expected 0 connections actual %d", connections)
+	}
+
+	if closed := mConnectionsIdleClosed.value(name); closed != idle+1 {
+		t.Errorf("expected %d idle connections actual %d", idle+1, closed)
+	}
+}
@@ -0,0 +1,313 @@
+package syslogsidecar
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/g41797/go-syslog"
+	"github.com/g41797/go-syslog/format"
+	"github.com/g41797/reuseport"
+)
+
+const (
+	// Default number of SO_REUSEPORT sockets per UDP address
+	defaultUDPSockets = 8
+
+	// Default size of receive buffer of UDP socket, the same as go-syslog
+	defaultUDPReadBuffer = 64 * 1024
+
+	maxDatagramSize = 65536
+)
+
+// Returns number of UDP sockets per address for configured value:
+// 0 - default (8), -1 - one per CPU.
+// Without SO_REUSEPORT support - always 1
+func udpSocketsOf(configured int) int {
+	if _, available := reuseport.Available(); !available {
+		return 1
+	}
+
+	switch {
+	case configured < 0:
+		return runtime.NumCPU()
+	case configured == 0:
+		return defaultUDPSockets
+	}
+
+	return configured
+}
+
+// UDP receiver: several SO_REUSEPORT sockets of the same address
+// with configured size of receive buffer.
+// Every socket has own goroutine, received datagrams are parsed
+// by format of go-syslog
+type datagramServer struct {
+	name    string
+	format  format.Format
+	handler syslog.Handler
+	conns   []net.PacketConn
+	inodes  []uint64
+	maxSize int
+	marker  []byte
+	access  *accessList
+	wait    sync.WaitGroup
+
+	listenerState
+}
+
+func newDatagramServer(name string, form format.Format, handler syslog.Handler) *datagramServer {
+	return &datagramServer{name: name, format: form, handler: handler}
+}
+
+// Checks senders of datagrams (nil - all senders are allowed)
+func (ds *datagramServer) setAccess(access *accessList) {
+	ds.access = access
+}
+
+// Truncates messages longer than max bytes (0 - without truncation)
+func (ds *datagramServer) setMaxMessageSize(max int, marker string) {
+	ds.maxSize = max
+	ds.marker = []byte(marker)
+	if len(marker) == 0 {
+		ds.marker = []byte(defaultTruncationMarker)
+	}
+}
+
+// Opens sockets for UDP address. Kernel may limit size of receive buffer
+// (see net.core.rmem_max)
+func (ds *datagramServer) ListenUDP(addr string, sockets int, readBuffer int) error {
+	if readBuffer <= 0 {
+		readBuffer = defaultUDPReadBuffer
+	}
+
+	for i := 0; i < sockets; i++ {
+		var conn net.PacketConn
+		var err error
+
+		if sockets > 1 {
+			conn, err = reuseport.ListenPacket("udp", addr)
+		} else {
+			conn, err = net.ListenPacket("udp", addr)
+		}
+
+		if err != nil {
+			ds.Kill()
+			return err
+		}
+
+		udpConn := conn.(*net.UDPConn)
+
+		if err = udpConn.SetReadBuffer(readBuffer); err != nil {
+			conn.Close()
+			ds.Kill()
+			return fmt.Errorf("cannot set SO_RCVBUF of %s: %v", addr, err)
+		}
+
+		ds.conns = append(ds.conns, conn)
+		ds.inodes = append(ds.inodes, socketInode(udpConn))
+	}
+
+	ds.bound.Store(true)
+
+	return nil
+}
+
+func (ds *datagramServer) Boot() error {
+	if ds.format == nil {
+		return fmt.Errorf("please set a valid format")
+	}
+
+	if ds.handler == nil {
+		return fmt.Errorf("please set a valid handler")
+	}
+
+	for _, conn := range ds.conns {
+		ds.wait.Add(1)
+		ds.loopStarted()
+		go ds.receive(conn)
+	}
+
+	return nil
+}
+
+func (ds *datagramServer) Kill() error {
+	var result error
+
+	ds.bound.Store(false)
+
+	for _, conn := range ds.conns {
+		if err := conn.Close(); err != nil {
+			result = err
+		}
+	}
+
+	return result
+}
+
+// Waits until all sockets are closed
+func (ds *datagramServer) Wait() {
+	ds.wait.Wait()
+}
+
+func (ds *datagramServer) receive(conn net.PacketConn) {
+	defer ds.wait.Done()
+	defer ds.loopFinished()
+
+	buf := make([]byte, maxDatagramSize)
+
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			// Closed socket or transitory error (e.g. interface is down)
+			opError, ok := err.(*net.OpError)
+			if ok && !opError.Temporary() && !opError.Timeout() {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+
+		if !ds.access.permits(addr) {
+			continue
+		}
+
+		// Ignore trailing control characters and NULs
+		for ; (n > 0) && (buf[n-1] < 32); n-- {
+		}
+
+		if n == 0 {
+			continue
+		}
+
+		var client string
+		if addr != nil {
+			client = addr.String()
+		}
+
+		ds.parse(buf[:n], client)
+	}
+}
+
+// Parses datagram the same way as go-syslog
+func (ds *datagramServer) parse(datagram []byte, client string) {
+	line := datagram
+
+	if sf := ds.format.GetSplitFunc(); sf != nil {
+		_, token, err := sf(datagram, true)
+		if err != nil {
+			return
+		}
+		line = token
+	}
+
+	if (ds.maxSize > 0) && (len(line) > ds.maxSize) {
+		line = truncateMessage(line, ds.maxSize, ds.marker)
+		mTruncated.inc(ds.name)
+	}
+
+	parseLine(ds.format, ds.handler, line, client, "")
+}
+
+// Parses received message and calls the handler, the same as go-syslog.
+// Returns error of parsing
+func parseLine(form format.Format, handler syslog.Handler, line []byte, client string, tlsPeer string) error {
+	parser := form.GetParser(line)
+	err := parser.Parse()
+
+	logParts := parser.Dump()
+	logParts["client"] = client
+	logParts["tls_peer"] = tlsPeer
+
+	if err != nil {
+		logParts["data"] = string(line)
+	}
+
+	handler.Handle(logParts, int64(len(line)), err)
+
+	return err
+}
+
+// Returns inode of the socket, used for search in /proc/net/udp.
+// 0 - not supported by OS
+func socketInode(conn *net.UDPConn) uint64 {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return 0
+	}
+
+	var link string
+
+	raw.Control(func(fd uintptr) {
+		link, _ = os.Readlink("/proc/self/fd/" + strconv.FormatUint(uint64(fd), 10))
+	})
+
+	// "socket:[12345]"
+	if !strings.HasPrefix(link, "socket:[") || !strings.HasSuffix(link, "]") {
+		return 0
+	}
+
+	inode, _ := strconv.ParseUint(link[len("socket:["):len(link)-1], 10, 64)
+
+	return inode
+}
+
+// Returns numbers of datagrams dropped by the kernel for UDP sockets
+// (key - inode of the socket)
+func udpKernelDrops() map[uint64]uint64 {
+	drops := make(map[uint64]uint64)
+
+	for _, path := range []string{"/proc/net/udp", "/proc/net/udp6"} {
+		f, err := os.Open(path)
+		if err != nil {
+			continue
+		}
+		parseProcUDP(f, drops)
+		f.Close()
+	}
+
+	return drops
+}
+
+// Parses /proc/net/udp:
+//
+//	sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops
+//	0: 0100007F:1415 00000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 31337 2 0000000000000000 42
+func parseProcUDP(r io.Reader, drops map[uint64]uint64) {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 13 {
+			continue
+		}
+
+		inode, err := strconv.ParseUint(fields[9], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		dropped, err := strconv.ParseUint(fields[12], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		drops[inode] = dropped
+	}
+}
+
+// Reports kernel drops of every socket of the listener
+func (ds *datagramServer) reportDrops(drops map[uint64]uint64, report func(val float64, lvalues ...string)) {
+	for i, inode := range ds.inodes {
+		if dropped, exists := drops[inode]; exists && (inode != 0) {
+			report(float64(dropped), ds.name, strconv.Itoa(i))
+		}
+	}
+}
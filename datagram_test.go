@@ -0,0 +1,87 @@
+package syslogsidecar
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/g41797/go-syslog/format"
+	"github.com/g41797/reuseport"
+)
+
+type logPartsChannel chan format.LogParts
+
+func (ch logPartsChannel) Handle(logParts format.LogParts, msgLen int64, err error) {
+	ch <- logParts
+}
+
+func Test_DatagramServer(t *testing.T) {
+	if _, available := reuseport.Available(); available {
+		if sockets := udpSocketsOf(0); sockets != defaultUDPSockets {
+			t.Errorf("expected %d sockets actual %d", defaultUDPSockets, sockets)
+		}
+		if sockets := udpSocketsOf(-1); sockets < 1 {
+			t.Errorf("expected socket per CPU actual %d", sockets)
+		}
+	}
+
+	received := make(logPartsChannel, 1)
+
+	form, _ := formatOfListener(nil, "udp", "127.0.0.1:5161", false)
+	ds := newDatagramServer(listenerName("udp", "127.0.0.1:5161"), form, received)
+
+	sockets := udpSocketsOf(3)
+
+	if err := ds.ListenUDP("127.0.0.1:5161", sockets, 256*1024); err != nil {
+		t.Fatalf("ListenUDP error %v", err)
+	}
+
+	if len(ds.conns) != sockets {
+		t.Errorf("expected %d sockets actual %d", sockets, len(ds.conns))
+	}
+
+	if err := ds.Boot(); err != nil {
+		t.Fatalf("Boot error %v", err)
+	}
+
+	conn, err := net.Dial("udp", "127.0.0.1:5161")
+	if err != nil {
+		t.Fatalf("Dial error %v", err)
+	}
+
+	conn.Write([]byte("<34>1 2003-10-11T22:14:15.003Z mymachine su - ID47 - datagram\n"))
+	conn.Close()
+
+	logParts := <-received
+
+	if logParts["message"] != "datagram" || !strings.HasPrefix(logParts["client"].(string), "127.0.0.1:") {
+		t.Errorf("wrong parsing %v", logParts)
+	}
+
+	reported := 0
+
+	ds.reportDrops(udpKernelDrops(), func(val float64, lvalues ...string) {
+		if lvalues[0] != "udp/127.0.0.1:5161" {
+			t.Errorf("wrong listener %v", lvalues)
+		}
+		reported++
+	})
+
+	// Inodes of sockets are available only on Linux
+	if (ds.inodes[0] != 0) && (reported != sockets) {
+		t.Errorf("expected drops of %d sockets actual %d", sockets, reported)
+	}
+
+	ds.Kill()
+	ds.Wait()
+
+	drops := make(map[uint64]uint64)
+	parseProcUDP(strings.NewReader(
+		"   sl  local_address rem_address   st tx_queue rx_queue tr tm->when retrnsmt   uid  timeout inode ref pointer drops\n"+
+			"  591: 0100007F:1415 00000000:0000 07 00000000:00000000 00:00000000 00000000     0        0 31337 2 0000000000000000 42\n"),
+		drops)
+
+	if len(drops) != 1 || drops[31337] != 42 {
+		t.Errorf("wrong parsing of /proc/net/udp %v", drops)
+	}
+}
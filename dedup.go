@@ -0,0 +1,254 @@
+package syslogsidecar
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/g41797/sputnik"
+)
+
+// Name of duplicate suppression processor and its configuration (dedup.json)
+const DedupName = "dedup"
+
+// Configuration of duplicate suppression processor is stored in dedup.json
+type DedupConfiguration struct {
+	// Messages are deduplicated according to the first matched rule,
+	// messages which do not match any rule are not deduplicated.
+	// Without rules all messages are deduplicated with default window
+	RULES []DedupRule
+
+	// Max number of tracked messages (default 10000).
+	// New messages above the limit are not deduplicated
+	MAX_ENTRIES int
+}
+
+// Rule of duplicate suppression
+type DedupRule struct {
+	// Selects messages by facility and severity, syntax is the same as in syslogconf.json,
+	// e.g. "local0.info,debug", "daemon,cron". Empty - all messages
+	SELECTOR string
+
+	// Repeats of the message received within WINDOW_MS milliseconds (default 30000)
+	// after the previous one are suppressed.
+	// Summary is sent when the message was not repeated during the window
+	// and at least once per window while repeats continue
+	WINDOW_MS int
+}
+
+// Extra parts of summary message
+const (
+	RepeatCountPart = "repeat_count"
+	RepeatFirstPart = "repeat_first"
+	RepeatLastPart  = "repeat_last"
+)
+
+const (
+	defaultDedupWindow     = 30 * time.Second
+	defaultDedupMaxEntries = 10000
+)
+
+type dedupRule struct {
+	selector *msgSelector
+	window   time.Duration
+}
+
+// Tracked message, key - hostname, app name and text of the message
+type dedupEntry struct {
+	window   time.Duration
+	seen     time.Time // the last receiving of the message
+	started  time.Time // receiving of the first suppressed repeat
+	count    int
+	firstTs  string
+	lastTs   string
+	last     sputnik.Msg // the last suppressed repeat, used for the summary
+	textPart string
+}
+
+type deduplicator struct {
+	conf    DedupConfiguration
+	rules   []dedupRule
+	lock    sync.Mutex
+	entries map[string]*dedupEntry
+	now     func() time.Time
+}
+
+func newDeduplicator() Processor {
+	return &deduplicator{entries: make(map[string]*dedupEntry), now: time.Now}
+}
+
+func init() {
+	RegisterProcessorFactory(DedupName, newDeduplicator)
+}
+
+func (dd *deduplicator) Init(cf sputnik.ConfFactory) error {
+	if err := readProcessorConfiguration(cf, DedupName, &dd.conf); err != nil {
+		return err
+	}
+
+	if dd.conf.MAX_ENTRIES <= 0 {
+		dd.conf.MAX_ENTRIES = defaultDedupMaxEntries
+	}
+
+	if len(dd.conf.RULES) == 0 {
+		dd.conf.RULES = []DedupRule{{}}
+	}
+
+	for i, rconf := range dd.conf.RULES {
+		rule := dedupRule{window: defaultDedupWindow}
+
+		if rconf.WINDOW_MS > 0 {
+			rule.window = time.Duration(rconf.WINDOW_MS) * time.Millisecond
+		}
+
+		if len(rconf.SELECTOR) > 0 {
+			selector, err := newMsgSelector(rconf.SELECTOR)
+			if err != nil {
+				return fmt.Errorf("dedup rule %d: %v", i, err)
+			}
+			rule.selector = selector
+		}
+
+		dd.rules = append(dd.rules, rule)
+	}
+
+	return nil
+}
+
+func (dd *deduplicator) Process(msg sputnik.Msg) []sputnik.Msg {
+	rule := dd.ruleOf(msg)
+	if rule == nil {
+		return []sputnik.Msg{msg}
+	}
+
+	parts, err := UnpackToMap(msg)
+	if err != nil {
+		return []sputnik.Msg{msg}
+	}
+
+	textPart := messagePartOf(parts)
+	appName := parts["app_name"]
+	if len(appName) == 0 {
+		appName = parts[rfc3164OnlyKey]
+	}
+	key := parts["hostname"] + "\x00" + appName + "\x00" + parts[textPart]
+
+	now := dd.now()
+
+	dd.lock.Lock()
+	defer dd.lock.Unlock()
+
+	entry, exists := dd.entries[key]
+
+	if !exists {
+		if len(dd.entries) < dd.conf.MAX_ENTRIES {
+			dd.entries[key] = &dedupEntry{window: rule.window, seen: now, textPart: textPart}
+		}
+		return []sputnik.Msg{msg}
+	}
+
+	if now.Sub(entry.seen) > entry.window {
+		// Not repeated during the window - summary of previous repeats and the message
+		result := dd.summary(entry)
+		entry.seen = now
+		return append(result, msg)
+	}
+
+	ts, exists := parts["timestamp"]
+	if !exists {
+		ts = now.Format(time.RFC3339)
+	}
+
+	if entry.count == 0 {
+		entry.started = now
+		entry.firstTs = ts
+	}
+
+	entry.count++
+	entry.lastTs = ts
+	entry.seen = now
+
+	if entry.last != nil {
+		Put(entry.last)
+	}
+	entry.last = msg
+
+	return nil
+}
+
+// Sends summaries of expired and long-running repeats, removes expired entries
+func (dd *deduplicator) Flush(final bool) []sputnik.Msg {
+	now := dd.now()
+
+	dd.lock.Lock()
+	defer dd.lock.Unlock()
+
+	var result []sputnik.Msg
+
+	for key, entry := range dd.entries {
+		expired := final || (now.Sub(entry.seen) > entry.window)
+
+		if expired || ((entry.count > 0) && (now.Sub(entry.started) >= entry.window)) {
+			result = append(result, dd.summary(entry)...)
+		}
+
+		if expired {
+			delete(dd.entries, key)
+		}
+	}
+
+	return result
+}
+
+// Converts the last suppressed repeat to "last message repeated N times"
+func (dd *deduplicator) summary(entry *dedupEntry) []sputnik.Msg {
+	if entry.count == 0 {
+		return nil
+	}
+
+	msg := entry.last
+	count := entry.count
+
+	entry.last = nil
+	entry.count = 0
+
+	parts, err := UnpackToMap(msg)
+	if err != nil {
+		Put(msg)
+		return nil
+	}
+
+	parts[entry.textPart] = fmt.Sprintf("last message repeated %d times", count)
+	parts[RepeatCountPart] = strconv.Itoa(count)
+	parts[RepeatFirstPart] = entry.firstTs
+	parts[RepeatLastPart] = entry.lastTs
+
+	if err = Pack(msg, parts); err != nil {
+		Put(msg)
+		return nil
+	}
+
+	return []sputnik.Msg{msg}
+}
+
+func (dd *deduplicator) ruleOf(msg sputnik.Msg) *dedupRule {
+	for i := range dd.rules {
+		if dd.rules[i].selector.match(msg) {
+			return &dd.rules[i]
+		}
+	}
+	return nil
+}
+
+// Returns name of the part with text of the message:
+// "message" for RFC5424, "content" for RFC3164, "data" for non-RFC message
+func messagePartOf(parts map[string]string) string {
+	switch parts[rfcFormatKey] {
+	case rfc5424:
+		return "message"
+	case rfc3164:
+		return "content"
+	}
+	return Formermessage
+}
@@ -0,0 +1,160 @@
+package syslogsidecar
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/g41797/sputnik"
+	"github.com/g41797/sputnik/sidecar"
+)
+
+// Packs RFC5424 message with the priority and the text
+func dedupMsg(priority int, message string) sputnik.Msg {
+	parts := makeRFC5424Msg()
+	parts["priority"] = strconv.Itoa(priority)
+	parts["message"] = message
+
+	msg := Get()
+	Pack(msg, parts)
+	return msg
+}
+
+func Test_Dedup(t *testing.T) {
+	conf := DedupConfiguration{
+		RULES: []DedupRule{
+			{SELECTOR: "local0.debug", WINDOW_MS: 1000},
+			{SELECTOR: "local0.info"},
+		},
+	}
+
+	prc := newDeduplicator()
+	if err := prc.Init(testConfFactory(DedupName, conf)); err != nil {
+		t.Fatalf("Init error %v", err)
+	}
+
+	dd := prc.(*deduplicator)
+	now := time.Now()
+	dd.now = func() time.Time { return now }
+
+	debug := 16*8 + 7
+	info := 16*8 + 6
+	err := 16*8 + 3
+
+	for i := 0; i < 4; i++ {
+		out := prc.Process(dedupMsg(debug, "chatty"))
+		if (i == 0) != (len(out) == 1) {
+			t.Fatalf("repeat %d: wrong number of messages %d", i, len(out))
+		}
+		now = now.Add(100 * time.Millisecond)
+	}
+
+	// Not selected by rules
+	for i := 0; i < 2; i++ {
+		if out := prc.Process(dedupMsg(err, "chatty")); len(out) != 1 {
+			t.Fatalf("message without rule should not be suppressed")
+		}
+	}
+
+	// Another text
+	if out := prc.Process(dedupMsg(debug, "another")); len(out) != 1 {
+		t.Fatalf("another message should not be suppressed")
+	}
+
+	if out := prc.Process(dedupMsg(info, "informative")); len(out) != 1 {
+		t.Fatalf("message of another rule should not be suppressed")
+	}
+
+	if out := dd.Flush(false); len(out) != 0 {
+		t.Fatalf("summary before end of the window")
+	}
+
+	now = now.Add(1100 * time.Millisecond)
+
+	out := dd.Flush(false)
+	if len(out) != 1 {
+		t.Fatalf("expected 1 summary actual %d", len(out))
+	}
+
+	checkPart(t, out[0], "message", "last message repeated 3 times", true)
+	checkPart(t, out[0], RepeatCountPart, "3", true)
+	Put(out[0])
+
+	// Window of the message expired - message is sent
+	if out := prc.Process(dedupMsg(debug, "chatty")); len(out) != 1 {
+		t.Fatalf("message after the window should not be suppressed")
+	}
+
+	prc.Process(dedupMsg(info, "chatty"))
+
+	if out := dd.Flush(true); len(out) != 1 {
+		t.Fatalf("final flush: expected 1 summary actual %d", len(out))
+	}
+
+	if len(dd.entries) != 0 {
+		t.Errorf("entries were not removed by final flush")
+	}
+}
+
+func Test_PipelineFlush(t *testing.T) {
+	var (
+		lock sync.Mutex
+		sent []string
+	)
+
+	pl := newPipeline(func(msg sputnik.Msg) {
+		text, _ := Part(msg, "message")
+		Put(msg)
+		lock.Lock()
+		sent = append(sent, text)
+		lock.Unlock()
+	})
+
+	if err := pl.init([]string{DedupName}, testConfFactory(DedupName, DedupConfiguration{}), 2); err != nil {
+		t.Fatalf("init error %v", err)
+	}
+
+	pl.start()
+
+	for i := 0; i < 5; i++ {
+		pl.push(dedupMsg(1, "repeated"))
+	}
+
+	pl.stop()
+
+	if len(sent) != 2 {
+		t.Fatalf("expected 2 messages actual %v", sent)
+	}
+
+	if sent[1] != "last message repeated 4 times" {
+		t.Errorf("wrong summary %s", sent[1])
+	}
+}
+
+// Pending summary is sent to the producer on stop of the receiver
+func Test_DedupOnStop(t *testing.T) {
+	line := "<134>1 2003-10-11T22:14:15.003Z mymachine app - - - repeated"
+
+	texts := receiveAndStop(t, DedupName, DedupConfiguration{}, []string{line, line, line})
+
+	if len(texts) != 2 || texts[0] != "repeated" || texts[1] != "last message repeated 2 times" {
+		t.Errorf("wrong messages %q", texts)
+	}
+}
+
+// Without dedup.json all messages are deduplicated
+func Test_DedupWithoutConfiguration(t *testing.T) {
+	prc := newDeduplicator()
+	if err := prc.Init(sidecar.ConfigFactory(t.TempDir())); err != nil {
+		t.Fatalf("Init without configuration error %v", err)
+	}
+
+	if out := prc.Process(dedupMsg(16*8+3, "text")); len(out) != 1 {
+		t.Fatalf("first message should be sent")
+	}
+
+	if out := prc.Process(dedupMsg(16*8+3, "text")); len(out) != 0 {
+		t.Errorf("repeated message should be suppressed")
+	}
+}
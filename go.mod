@@ -8,15 +8,17 @@ require (
 	github.com/asaskevich/EventBus v0.0.0-20200907212545-49d423059eef
 	github.com/g41797/go-syslog v1.0.11
 	github.com/g41797/kissngoqueue v0.1.5
+	github.com/g41797/reuseport v0.4.5
 	github.com/g41797/sputnik v0.0.18
+	golang.org/x/net v0.17.0
 )
 
 require (
 	github.com/bits-and-blooms/bitset v1.2.0 // indirect
 	github.com/g41797/gonfig v1.0.1 // indirect
-	github.com/g41797/reuseport v0.4.5 // indirect
 	github.com/ghodss/yaml v1.0.0 // indirect
 	github.com/mschoch/smat v0.2.0 // indirect
 	golang.org/x/sys v0.13.0 // indirect
+	golang.org/x/text v0.13.0 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
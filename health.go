@@ -0,0 +1,104 @@
+package syslogsidecar
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// Result of one health check
+type checkResult struct {
+	Name   string `json:"name"`
+	Ok     bool   `json:"ok"`
+	Status string `json:"status,omitempty"`
+}
+
+// Returns results of the checks of the component
+type healthCheck func() []checkResult
+
+type healthSource struct {
+	liveness bool
+	check    healthCheck
+}
+
+// Health checks of components of the pipeline.
+// Liveness checks are used by /healthz and /readyz,
+// readiness checks - only by /readyz
+type healthRegistry struct {
+	lock    sync.Mutex
+	sources map[string][]healthSource
+}
+
+var health = &healthRegistry{sources: make(map[string][]healthSource)}
+
+// Adds check of the component (owner)
+func (hr *healthRegistry) add(owner string, liveness bool, check healthCheck) {
+	hr.lock.Lock()
+	defer hr.lock.Unlock()
+	hr.sources[owner] = append(hr.sources[owner], healthSource{liveness, check})
+}
+
+// Removes all checks of the component, e.g. after stop
+func (hr *healthRegistry) remove(owner string) {
+	hr.lock.Lock()
+	defer hr.lock.Unlock()
+	delete(hr.sources, owner)
+}
+
+// Runs checks, returns results and summary status
+func (hr *healthRegistry) run(readiness bool) ([]checkResult, bool) {
+	hr.lock.Lock()
+	owners := make([]string, 0, len(hr.sources))
+	for owner := range hr.sources {
+		owners = append(owners, owner)
+	}
+	sort.Strings(owners)
+
+	var checks []healthCheck
+	for _, owner := range owners {
+		for _, src := range hr.sources[owner] {
+			if src.liveness || readiness {
+				checks = append(checks, src.check)
+			}
+		}
+	}
+	hr.lock.Unlock()
+
+	results := make([]checkResult, 0)
+	ok := true
+
+	for _, check := range checks {
+		for _, res := range check() {
+			ok = ok && res.Ok
+			results = append(results, res)
+		}
+	}
+
+	return results, ok
+}
+
+type healthReport struct {
+	Status string        `json:"status"`
+	Checks []checkResult `json:"checks"`
+}
+
+// Returns handler of /healthz (readiness == false) or /readyz (readiness == true).
+// Status code is 200 for passed checks and 503 otherwise
+func (hr *healthRegistry) handler(readiness bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		results, ok := hr.run(readiness)
+
+		report := healthReport{Status: "ok", Checks: results}
+		code := http.StatusOK
+
+		if !ok {
+			report.Status = "fail"
+			code = http.StatusServiceUnavailable
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(report)
+	})
+}
@@ -0,0 +1,156 @@
+package syslogsidecar
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/g41797/kissngoqueue"
+	"github.com/g41797/sputnik"
+)
+
+func Test_ProducerReadiness(t *testing.T) {
+	np := newNamedProducer("health", nil)
+	np.conf.READY_DISCONNECTED_MS = 1000
+	np.conf.READY_SPOOL_RATIO = 0.5
+
+	np.disconnectedAt.Store(time.Now().Add(-2 * time.Second).UnixNano())
+
+	if checkOk(np.checkReadiness()) {
+		t.Errorf("producer disconnected longer than threshold should not be ready")
+	}
+
+	np.setConnected(true)
+
+	if !checkOk(np.checkReadiness()) {
+		t.Errorf("connected producer should be ready")
+	}
+
+	np.setConnected(false)
+
+	if !checkOk(np.checkReadiness()) {
+		t.Errorf("just disconnected producer should be ready")
+	}
+
+	sp, err := openSpool(t.TempDir(), "health", 2)
+	if err != nil {
+		t.Fatalf("open spool error %v", err)
+	}
+	defer sp.close()
+
+	np.spool = sp
+
+	msg := Get()
+	Pack(msg, makeRFC5424Msg())
+	sp.put(msg)
+	Put(msg)
+
+	if checkOk(np.checkReadiness()) {
+		t.Errorf("producer with spool near capacity should not be ready")
+	}
+}
+
+func checkOk(results []checkResult) bool {
+	for _, res := range results {
+		if !res.Ok {
+			return false
+		}
+	}
+	return true
+}
+
+func Test_HealthEndpoints(t *testing.T) {
+	conf := defaultServerConfiguration()
+	conf.ADDRHTTP = "127.0.0.1:9515"
+
+	srv := newServer(conf)
+
+	if err := srv.initServer(); err != nil {
+		t.Fatalf("Init error %v", err)
+	}
+
+	srv.setupHandling(nil)
+
+	if err := srv.start(); err != nil {
+		t.Fatalf("Start syslogd error %v", err)
+	}
+
+	defer srv.stop()
+
+	checkEndpoint(t, "http://"+conf.ADDRHTTP+"/healthz", http.StatusOK)
+	checkEndpoint(t, "http://"+conf.ADDRHTTP+"/readyz", http.StatusServiceUnavailable)
+
+	srv.setupHandling(newCommunicator(kissngoqueue.NewQueue[sputnik.Msg]()))
+
+	report := checkEndpoint(t, "http://"+conf.ADDRHTTP+"/readyz", http.StatusOK)
+
+	found := false
+	for _, res := range report.Checks {
+		if res.Name == "listener tcp/127.0.0.1:5141" {
+			found = res.Ok
+		}
+	}
+
+	if !found {
+		t.Errorf("status of tcp listener not found in %v", report.Checks)
+	}
+}
+
+func checkEndpoint(t *testing.T, url string, code int) healthReport {
+	var report healthReport
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("get %s error %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != code {
+		t.Errorf("%s: expected status %d actual %d", url, code, resp.StatusCode)
+	}
+
+	if err = json.NewDecoder(resp.Body).Decode(&report); err != nil {
+		t.Errorf("%s: decode error %v", url, err)
+	}
+
+	return report
+}
+
+// Closed listener is reported by liveness check, other listeners are still running
+func Test_ListenerState(t *testing.T) {
+	conf := defaultServerConfiguration()
+	conf.ADDRTCP = "127.0.0.1:5143"
+	conf.ADDRUDP = "127.0.0.1:5143"
+
+	srv := newServer(conf)
+
+	if err := srv.initServer(); err != nil {
+		t.Fatalf("Init error %v", err)
+	}
+
+	if err := srv.start(); err != nil {
+		t.Fatalf("Start syslogd error %v", err)
+	}
+
+	defer srv.stop()
+
+	states := func() map[string]bool {
+		result := make(map[string]bool)
+		for _, res := range srv.checkListeners() {
+			result[res.Name] = res.Ok
+		}
+		return result
+	}
+
+	if st := states(); !st["listener tcp/127.0.0.1:5143"] || !st["listener udp/127.0.0.1:5143"] {
+		t.Fatalf("listeners should be running %v", st)
+	}
+
+	srv.datagrams[0].Kill()
+	srv.datagrams[0].Wait()
+
+	if st := states(); !st["listener tcp/127.0.0.1:5143"] || st["listener udp/127.0.0.1:5143"] {
+		t.Errorf("only udp listener should be stopped %v", st)
+	}
+}
@@ -0,0 +1,55 @@
+package syslogsidecar
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+)
+
+// HTTP listener for metrics and other admin endpoints
+type httpServer struct {
+	lstn net.Listener
+	mux  *http.ServeMux
+	srv  *http.Server
+}
+
+// Listens on addr, serving starts by start()
+func newHTTPServer(addr string) (*httpServer, error) {
+	lstn, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	hs := new(httpServer)
+	hs.lstn = lstn
+	hs.mux = http.NewServeMux()
+	hs.srv = &http.Server{Handler: hs.mux, ReadHeaderTimeout: 5 * time.Second}
+
+	return hs, nil
+}
+
+func (hs *httpServer) handle(pattern string, handler http.Handler) {
+	hs.mux.Handle(pattern, handler)
+}
+
+func (hs *httpServer) start() {
+	if hs == nil {
+		return
+	}
+
+	go hs.srv.Serve(hs.lstn)
+}
+
+func (hs *httpServer) stop() {
+	if hs == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := hs.srv.Shutdown(ctx); err != nil {
+		hs.srv.Close()
+	}
+}
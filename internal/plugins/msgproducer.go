@@ -60,13 +60,12 @@ func (mpr *msgProducer) Produce(msg sputnik.Msg) error {
 		}
 	*/
 	props, err := syslogsidecar.UnpackToMap(msg)
-
-	syslogsidecar.Put(msg)
-
 	if err != nil {
-		return err
+		return syslogsidecar.PermanentError(err)
 	}
 
+	syslogsidecar.Put(msg)
+
 	mpr.ebus.Publish(mpr.conf.TOPIC, props)
 
 	return nil
@@ -0,0 +1,159 @@
+package syslogsidecar
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/g41797/sputnik"
+)
+
+// Name of JSON body parsing processor and its configuration (json.json)
+const JSONName = "json"
+
+// Configuration of JSON body parsing processor is stored in json.json.
+// The file is optional
+type JSONConfiguration struct {
+	// Prefix of names of parsed parts (default "json.")
+	PREFIX string
+
+	// Depth of flattening of nested objects (default 3):
+	// {"http": {"request": {"method": "GET"}}} -> "json.http.request.method".
+	// Deeper objects and arrays are saved as JSON text
+	MAX_DEPTH int
+
+	// Separator of names of nested keys (default ".")
+	SEPARATOR string
+
+	// Parse only payloads with "@cee:" cookie, otherwise
+	// any payload which starts from '{' is parsed
+	CEE_ONLY bool
+}
+
+// Cookie of CEE (Common Event Expression) JSON payload
+const ceeCookie = "@cee:"
+
+type jsonParser struct {
+	conf JSONConfiguration
+}
+
+func newJSONParser() Processor {
+	return new(jsonParser)
+}
+
+func init() {
+	RegisterProcessorFactory(JSONName, newJSONParser)
+}
+
+func (jp *jsonParser) Init(cf sputnik.ConfFactory) error {
+	if err := readProcessorConfiguration(cf, JSONName, &jp.conf); err != nil {
+		return err
+	}
+
+	if len(jp.conf.PREFIX) == 0 {
+		jp.conf.PREFIX = "json."
+	}
+
+	if jp.conf.MAX_DEPTH <= 0 {
+		jp.conf.MAX_DEPTH = 3
+	}
+
+	if len(jp.conf.SEPARATOR) == 0 {
+		jp.conf.SEPARATOR = "."
+	}
+
+	return nil
+}
+
+// Parses JSON payload of "message" (RFC5424), "content" (RFC3164) or "data"
+// and adds flattened fields as parts, e.g. "json.level", "json.trace_id"
+func (jp *jsonParser) Process(msg sputnik.Msg) []sputnik.Msg {
+	parts, err := UnpackToMap(msg)
+	if err != nil {
+		return []sputnik.Msg{msg}
+	}
+
+	body, found := jp.bodyOf(parts)
+	if !found {
+		return []sputnik.Msg{msg}
+	}
+
+	var object map[string]any
+
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+
+	if err = decoder.Decode(&object); err != nil {
+		mParsed.inc(JSONName, parseFailed)
+		return []sputnik.Msg{msg}
+	}
+
+	jp.flatten(parts, jp.conf.PREFIX, object, 1)
+
+	if err = Pack(msg, parts); err != nil {
+		mParsed.inc(JSONName, parseFailed)
+		return []sputnik.Msg{msg}
+	}
+
+	mParsed.inc(JSONName, parseParsed)
+
+	return []sputnik.Msg{msg}
+}
+
+// Returns JSON text of the payload
+func (jp *jsonParser) bodyOf(parts map[string]string) (string, bool) {
+	payload := payloadOf(parts)
+
+	if parts[rfcFormatKey] == rfc3164 && parts[rfc3164OnlyKey]+":" == ceeCookie {
+		return payload, true
+	}
+
+	if strings.HasPrefix(payload, ceeCookie) {
+		return strings.TrimLeft(payload[len(ceeCookie):], " "), true
+	}
+
+	if jp.conf.CEE_ONLY || !strings.HasPrefix(payload, "{") {
+		return "", false
+	}
+
+	return payload, true
+}
+
+func (jp *jsonParser) flatten(parts map[string]string, prefix string, object map[string]any, depth int) {
+	for key, val := range object {
+		name := prefix + key
+
+		switch typed := val.(type) {
+		case map[string]any:
+			if depth < jp.conf.MAX_DEPTH {
+				jp.flatten(parts, name+jp.conf.SEPARATOR, typed, depth+1)
+				continue
+			}
+			parts[name] = jsonText(typed)
+		case []any:
+			parts[name] = jsonText(typed)
+		case string:
+			parts[name] = typed
+		case json.Number:
+			parts[name] = typed.String()
+		case bool:
+			if typed {
+				parts[name] = "true"
+			} else {
+				parts[name] = "false"
+			}
+		case nil:
+			parts[name] = ""
+		}
+	}
+}
+
+func jsonText(val any) string {
+	var buf bytes.Buffer
+
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	encoder.Encode(val)
+
+	return strings.TrimSuffix(buf.String(), "\n")
+}
@@ -0,0 +1,63 @@
+package syslogsidecar
+
+import (
+	"testing"
+)
+
+func Test_JSONBody(t *testing.T) {
+	prc := newJSONParser()
+	if err := prc.Init(testConfFactory(JSONName, JSONConfiguration{MAX_DEPTH: 2})); err != nil {
+		t.Fatalf("Init error %v", err)
+	}
+
+	for _, text := range []string{
+		`@cee: {"level":"error","trace_id":"abc","http":{"status":500,"req":{"method":"GET"}},"tags":["a","b"],"ok":false,"user":null}`,
+		`{"level":"error","trace_id":"abc","http":{"status":500,"req":{"method":"GET"}},"tags":["a","b"],"ok":false,"user":null}`,
+	} {
+		parts := makeRFC5424Msg()
+		parts["message"] = text
+
+		result := processParts(t, prc, parts)
+
+		expected := map[string]string{
+			"json.level":       "error",
+			"json.trace_id":    "abc",
+			"json.http.status": "500",
+			"json.http.req":    `{"method":"GET"}`,
+			"json.tags":        `["a","b"]`,
+			"json.ok":          "false",
+			"json.user":        "",
+			"message":          text,
+		}
+
+		for name, val := range expected {
+			if actual, exists := result[name]; !exists || actual != val {
+				t.Errorf("part %s: expected %q actual %q", name, val, actual)
+			}
+		}
+	}
+
+	cee := newJSONParser()
+	if err := cee.Init(testConfFactory(JSONName, JSONConfiguration{PREFIX: "app_", SEPARATOR: "_", CEE_ONLY: true})); err != nil {
+		t.Fatalf("Init error %v", err)
+	}
+
+	parts := makeRFC3164Msg()
+	parts["content"] = `{"level":"info"}`
+
+	if result := processParts(t, cee, parts); len(result["app_level"]) != 0 {
+		t.Errorf("plain JSON should not be parsed for CEE_ONLY")
+	}
+
+	parts["content"] = `@cee:{"http":{"status":200}}`
+
+	if result := processParts(t, cee, parts); result["app_http_status"] != "200" {
+		t.Errorf("wrong parsing of CEE payload %v", result)
+	}
+
+	parts["content"] = `{"level":`
+
+	if result := processParts(t, prc, parts); result["content"] != `{"level":` {
+		t.Errorf("wrong JSON should not change the message")
+	}
+}
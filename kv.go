@@ -0,0 +1,219 @@
+package syslogsidecar
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/g41797/sputnik"
+)
+
+// Name of key=value extraction processor and its configuration (kv.json)
+const KVName = "kv"
+
+// Configuration of key=value (logfmt) extraction processor is stored in kv.json.
+// The file is optional
+type KVConfiguration struct {
+	// Prefix of names of extracted parts (default "kv.")
+	PREFIX string
+
+	// Separator of the key and the value (default "=")
+	SEPARATOR string
+
+	// Quote of values with spaces (default "\""). Quote within the value is escaped by '\'
+	QUOTE string
+
+	// Allowed characters of the key in syntax of regular expression character class
+	// (default "A-Za-z0-9_.\\-"). Pairs with another keys are skipped
+	KEY_CHARS string
+
+	// Max number of extracted pairs (default 64)
+	MAX_PAIRS int
+
+	// Extraction is used only for messages of the applications (app_name, for RFC3164 - tag)
+	// and received by the listeners (e.g. "udp/0.0.0.0:514", see Source).
+	// Empty - all applications and listeners
+	APP_NAMES []string
+	LISTENERS []string
+}
+
+type kvExtractor struct {
+	conf      KVConfiguration
+	key       *regexp.Regexp
+	quote     byte
+	apps      map[string]bool
+	listeners map[string]bool
+}
+
+func newKVExtractor() Processor {
+	return new(kvExtractor)
+}
+
+func init() {
+	RegisterProcessorFactory(KVName, newKVExtractor)
+}
+
+func (kv *kvExtractor) Init(cf sputnik.ConfFactory) error {
+	if err := readProcessorConfiguration(cf, KVName, &kv.conf); err != nil {
+		return err
+	}
+
+	if len(kv.conf.PREFIX) == 0 {
+		kv.conf.PREFIX = "kv."
+	}
+
+	if len(kv.conf.SEPARATOR) == 0 {
+		kv.conf.SEPARATOR = "="
+	}
+
+	if len(kv.conf.QUOTE) == 0 {
+		kv.conf.QUOTE = `"`
+	}
+
+	if len(kv.conf.QUOTE) != 1 {
+		return fmt.Errorf("QUOTE should be single character")
+	}
+	kv.quote = kv.conf.QUOTE[0]
+
+	if len(kv.conf.KEY_CHARS) == 0 {
+		kv.conf.KEY_CHARS = `A-Za-z0-9_.\-`
+	}
+
+	key, err := regexp.Compile("^[" + kv.conf.KEY_CHARS + "]+$")
+	if err != nil {
+		return fmt.Errorf("wrong KEY_CHARS: %v", err)
+	}
+	kv.key = key
+
+	if kv.conf.MAX_PAIRS <= 0 {
+		kv.conf.MAX_PAIRS = 64
+	}
+
+	kv.apps = toSet(kv.conf.APP_NAMES)
+	kv.listeners = toSet(kv.conf.LISTENERS)
+
+	return nil
+}
+
+// Extracts key=value pairs of "message" (RFC5424), "content" (RFC3164) or "data"
+// and adds them as parts, e.g. "kv.action", "kv.src"
+func (kv *kvExtractor) Process(msg sputnik.Msg) []sputnik.Msg {
+	if len(kv.listeners) > 0 {
+		if _, listener := Source(msg); !kv.listeners[listener] {
+			return []sputnik.Msg{msg}
+		}
+	}
+
+	parts, err := UnpackToMap(msg)
+	if err != nil {
+		return []sputnik.Msg{msg}
+	}
+
+	if len(kv.apps) > 0 {
+		appName, exists := parts["app_name"]
+		if !exists {
+			appName = parts[rfc3164OnlyKey]
+		}
+		if !kv.apps[appName] {
+			return []sputnik.Msg{msg}
+		}
+	}
+
+	pairs := kv.extract(payloadOf(parts))
+	if len(pairs) == 0 {
+		return []sputnik.Msg{msg}
+	}
+
+	for _, pair := range pairs {
+		parts[kv.conf.PREFIX+pair[0]] = pair[1]
+	}
+
+	if err = Pack(msg, parts); err != nil {
+		mParsed.inc(KVName, parseFailed)
+		return []sputnik.Msg{msg}
+	}
+
+	mParsed.inc(KVName, parseParsed)
+
+	return []sputnik.Msg{msg}
+}
+
+// Extracts pairs separated by spaces, words without separator are skipped
+func (kv *kvExtractor) extract(text string) [][2]string {
+	var pairs [][2]string
+
+	for pos := 0; pos < len(text) && len(pairs) < kv.conf.MAX_PAIRS; {
+		for pos < len(text) && isSpace(text[pos]) {
+			pos++
+		}
+
+		start := pos
+		for pos < len(text) && !isSpace(text[pos]) && !strings.HasPrefix(text[pos:], kv.conf.SEPARATOR) {
+			pos++
+		}
+		key := text[start:pos]
+
+		if pos >= len(text) || isSpace(text[pos]) {
+			continue
+		}
+
+		pos += len(kv.conf.SEPARATOR)
+
+		var value string
+		value, pos = kv.value(text, pos)
+
+		if kv.key.MatchString(key) {
+			pairs = append(pairs, [2]string{key, value})
+		}
+	}
+
+	return pairs
+}
+
+// Returns value started at pos (quoted or till space) and position after the value
+func (kv *kvExtractor) value(text string, pos int) (string, int) {
+	if pos >= len(text) || text[pos] != kv.quote {
+		start := pos
+		for pos < len(text) && !isSpace(text[pos]) {
+			pos++
+		}
+		return text[start:pos], pos
+	}
+
+	var sb strings.Builder
+
+	for pos++; pos < len(text); pos++ {
+		c := text[pos]
+
+		if c == '\\' && pos+1 < len(text) && (text[pos+1] == kv.quote || text[pos+1] == '\\') {
+			pos++
+			sb.WriteByte(text[pos])
+			continue
+		}
+
+		if c == kv.quote {
+			return sb.String(), pos + 1
+		}
+
+		sb.WriteByte(c)
+	}
+
+	// Not closed quote - the rest of the text
+	return sb.String(), pos
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t'
+}
+
+func toSet(list []string) map[string]bool {
+	if len(list) == 0 {
+		return nil
+	}
+
+	set := make(map[string]bool, len(list))
+	for _, item := range list {
+		set[item] = true
+	}
+	return set
+}
@@ -0,0 +1,73 @@
+package syslogsidecar
+
+import (
+	"reflect"
+	"testing"
+)
+
+func Test_KV(t *testing.T) {
+	prc := newKVExtractor()
+	if err := prc.Init(testConfFactory(KVName, KVConfiguration{MAX_PAIRS: 5})); err != nil {
+		t.Fatalf("Init error %v", err)
+	}
+
+	kv := prc.(*kvExtractor)
+
+	for _, tc := range []struct {
+		text     string
+		expected [][2]string
+	}{
+		{
+			`action=allow src=10.0.0.1 msg="user \"admin\" logged in" path=C:\temp`,
+			[][2]string{{"action", "allow"}, {"src", "10.0.0.1"}, {"msg", `user "admin" logged in`}, {"path", `C:\temp`}},
+		},
+		{
+			`Connection closed by peer=10.1.1.1 port=22 bad$key=1 url=http://x/?a=b empty=`,
+			[][2]string{{"peer", "10.1.1.1"}, {"port", "22"}, {"url", "http://x/?a=b"}, {"empty", ""}},
+		},
+		{
+			`a=1 b=2 c=3 d=4 e=5 f=6`,
+			[][2]string{{"a", "1"}, {"b", "2"}, {"c", "3"}, {"d", "4"}, {"e", "5"}},
+		},
+		{
+			`no pairs here`,
+			nil,
+		},
+	} {
+		if actual := kv.extract(tc.text); !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("%s: expected %v actual %v", tc.text, tc.expected, actual)
+		}
+	}
+
+	parts := makeRFC3164Msg()
+	parts["content"] = `level=warn component="disk monitor"`
+
+	result := processParts(t, prc, parts)
+
+	if result["kv.level"] != "warn" || result["kv.component"] != "disk monitor" {
+		t.Errorf("wrong extraction %v", result)
+	}
+
+	// Configured separator and quote, only for application "fw"
+	fw := newKVExtractor()
+	conf := KVConfiguration{PREFIX: "fw.", SEPARATOR: ":", QUOTE: "'", APP_NAMES: []string{"fw"}}
+	if err := fw.Init(testConfFactory(KVName, conf)); err != nil {
+		t.Fatalf("Init error %v", err)
+	}
+
+	parts = makeRFC5424Msg()
+	parts["app_name"] = "fw"
+	parts["message"] = `rule:'allow ssh' dst:10.0.0.2`
+
+	result = processParts(t, fw, parts)
+
+	if result["fw.rule"] != "allow ssh" || result["fw.dst"] != "10.0.0.2" {
+		t.Errorf("wrong extraction %v", result)
+	}
+
+	parts["app_name"] = "web"
+
+	if result = processParts(t, fw, parts); len(result["fw.rule"]) != 0 {
+		t.Errorf("extraction should be used only for app fw")
+	}
+}
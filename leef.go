@@ -0,0 +1,162 @@
+package syslogsidecar
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/g41797/sputnik"
+)
+
+// Name of LEEF parsing processor and its configuration (leef.json)
+const LEEFName = "leef"
+
+// Configuration of LEEF (IBM QRadar Log Event Extended Format) parsing processor
+// is stored in leef.json. The file is optional
+type LEEFConfiguration struct {
+	// Prefix of names of parsed parts (default "leef.")
+	PREFIX string
+}
+
+// Names of LEEF header fields (without prefix)
+var leefHeader = [...]string{
+	"version",
+	"vendor",
+	"product",
+	"product_version",
+	"event_id",
+	"delimiter", // LEEF 2.0 only
+}
+
+type leefParser struct {
+	conf LEEFConfiguration
+}
+
+func newLEEFParser() Processor {
+	return new(leefParser)
+}
+
+func init() {
+	RegisterProcessorFactory(LEEFName, newLEEFParser)
+}
+
+func (lp *leefParser) Init(cf sputnik.ConfFactory) error {
+	if err := readProcessorConfiguration(cf, LEEFName, &lp.conf); err != nil {
+		return err
+	}
+
+	if len(lp.conf.PREFIX) == 0 {
+		lp.conf.PREFIX = "leef."
+	}
+
+	return nil
+}
+
+// Parses LEEF payload of "message" (RFC5424), "content" (RFC3164) or "data"
+// and adds header fields and attributes as parts, e.g. "leef.vendor", "leef.src"
+func (lp *leefParser) Process(msg sputnik.Msg) []sputnik.Msg {
+	parts, err := UnpackToMap(msg)
+	if err != nil {
+		return []sputnik.Msg{msg}
+	}
+
+	payload, found := markedPayload(parts, "LEEF:")
+	if !found {
+		return []sputnik.Msg{msg}
+	}
+
+	header, attributes, ok := parseLEEF(payload)
+	if !ok {
+		mParsed.inc(LEEFName, parseFailed)
+		return []sputnik.Msg{msg}
+	}
+
+	for i, val := range header {
+		parts[lp.conf.PREFIX+leefHeader[i]] = val
+	}
+
+	for _, kv := range attributes {
+		parts[lp.conf.PREFIX+kv[0]] = kv[1]
+	}
+
+	if err = Pack(msg, parts); err != nil {
+		mParsed.inc(LEEFName, parseFailed)
+		return []sputnik.Msg{msg}
+	}
+
+	mParsed.inc(LEEFName, parseParsed)
+
+	return []sputnik.Msg{msg}
+}
+
+// Parses
+//
+//	LEEF:1.0|Vendor|Product|Version|EventID|key=value<tab>key=value
+//	LEEF:2.0|Vendor|Product|Version|EventID|Delimiter|key=value<delimiter>key=value
+//	LEEF:2.0|Vendor|Product|Version|EventID|key=value<tab>key=value
+//
+// https://www.ibm.com/docs/en/dsm?topic=leef-overview
+func parseLEEF(payload string) (header []string, attributes [][2]string, ok bool) {
+	payload = strings.TrimPrefix(payload, "LEEF:")
+
+	fields := len(leefHeader) - 1
+
+	header = strings.SplitN(payload, "|", fields+1)
+	if len(header) < fields {
+		return nil, nil, false
+	}
+
+	var rest string
+	if len(header) > fields {
+		rest = header[fields]
+		header = header[:fields]
+	}
+
+	delimiter := "\t"
+
+	// Delimiter field of LEEF 2.0 is optional: it is used only if it looks
+	// like a delimiter, otherwise the attributes follow the event id
+	if strings.HasPrefix(header[0], "2") {
+		field, after, _ := strings.Cut(rest, "|")
+		if dlm, isDelimiter := leefDelimiter(field); isDelimiter {
+			header = append(header, field)
+			delimiter = dlm
+			rest = after
+		}
+	}
+
+	for _, attr := range strings.Split(rest, delimiter) {
+		key, val, found := strings.Cut(attr, "=")
+		key = strings.TrimSpace(key)
+		if !found || len(key) == 0 {
+			continue
+		}
+		attributes = append(attributes, [2]string{key, val})
+	}
+
+	return header, attributes, true
+}
+
+// Converts delimiter field of LEEF 2.0: single character or its hex code ("x09", "0x09").
+// Empty field - tab. false - the field is not a delimiter
+func leefDelimiter(field string) (string, bool) {
+	if len(field) == 0 {
+		return "\t", true
+	}
+
+	if len([]rune(field)) == 1 {
+		return field, true
+	}
+
+	lower := strings.ToLower(field)
+	hex := strings.TrimPrefix(strings.TrimPrefix(lower, "0x"), "x")
+	if len(hex) == len(lower) || len(hex) == 0 {
+		return "", false
+	}
+
+	code, err := strconv.ParseUint(hex, 16, 8)
+	if err != nil {
+		return "", false
+	}
+
+	return string(rune(code)), true
+}
@@ -0,0 +1,63 @@
+package syslogsidecar
+
+import (
+	"testing"
+)
+
+func Test_LEEF(t *testing.T) {
+	prc := newLEEFParser()
+	if err := prc.Init(testConfFactory(LEEFName, LEEFConfiguration{PREFIX: "fw."})); err != nil {
+		t.Fatalf("Init error %v", err)
+	}
+
+	for _, tc := range []struct {
+		payload  string
+		expected map[string]string
+	}{
+		{
+			"LEEF:1.0|Microsoft|MSExchange|4.0 SP1|15345|src=10.50.1.1\tdst=2.10.20.20\tsev=5",
+			map[string]string{
+				"fw.version": "1.0", "fw.vendor": "Microsoft", "fw.product": "MSExchange",
+				"fw.product_version": "4.0 SP1", "fw.event_id": "15345",
+				"fw.src": "10.50.1.1", "fw.dst": "2.10.20.20", "fw.sev": "5",
+			},
+		},
+		{
+			"LEEF:2.0|Lancope|StealthWatch|1.0|41|^|src=10.0.1.8^dst=10.0.0.5^url=http://x/?a=b",
+			map[string]string{
+				"fw.version": "2.0", "fw.event_id": "41", "fw.delimiter": "^",
+				"fw.src": "10.0.1.8", "fw.dst": "10.0.0.5", "fw.url": "http://x/?a=b",
+			},
+		},
+		{
+			"LEEF:2.0|Vendor|Product|1.0|login|x7C|usrName=admin|action=allow",
+			map[string]string{"fw.usrName": "admin", "fw.action": "allow"},
+		},
+		{
+			"LEEF:2.0|Vendor|Product|1.0|login|usrName=admin\taction=allow",
+			map[string]string{"fw.event_id": "login", "fw.delimiter": "", "fw.usrName": "admin", "fw.action": "allow"},
+		},
+		{
+			"LEEF:2.0|Vendor|Product|1.0|login|0x5E|usrName=admin^action=allow",
+			map[string]string{"fw.delimiter": "0x5E", "fw.usrName": "admin", "fw.action": "allow"},
+		},
+	} {
+		parts := makeRFC3164Msg()
+		parts["content"] = tc.payload
+
+		result := processParts(t, prc, parts)
+
+		for name, val := range tc.expected {
+			if result[name] != val {
+				t.Errorf("%s part %s: expected %q actual %q", tc.payload, name, val, result[name])
+			}
+		}
+	}
+
+	parts := makeRFC5424Msg()
+	parts["message"] = "LEEF:1.0|Vendor"
+
+	if result := processParts(t, prc, parts); len(result["fw.version"]) != 0 {
+		t.Errorf("malformed LEEF should not be parsed")
+	}
+}
@@ -0,0 +1,341 @@
+package syslogsidecar
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/g41797/go-syslog/format"
+	"github.com/g41797/sputnik"
+)
+
+// Policies for full queue of received messages
+const (
+	OverflowBlock      = "block"
+	OverflowDropNewest = "drop-newest"
+	OverflowDropOldest = "drop-oldest"
+	OverflowBySeverity = "drop-by-severity"
+	OverflowSpill      = "spill"
+)
+
+func isOverflowPolicy(policy string) bool {
+	switch policy {
+	case OverflowBlock, OverflowDropNewest, OverflowDropOldest, OverflowBySeverity, OverflowSpill:
+		return true
+	}
+	return false
+}
+
+// Counters of discarded messages
+type queueDrops struct {
+	newest     atomic.Uint64
+	oldest     atomic.Uint64
+	bySeverity atomic.Uint64
+	spill      atomic.Uint64
+}
+
+func (qd *queueDrops) total() uint64 {
+	return qd.newest.Load() + qd.oldest.Load() + qd.bySeverity.Load() + qd.spill.Load()
+}
+
+type queued struct {
+	logParts format.LogParts
+	// Not nil for message restored from spill
+	msg      sputnik.Msg
+	size     int
+	severity int
+	// Element of FIFO of the severity
+	bySeverity *list.Element
+}
+
+// Default limit of the number of messages in the queue
+const defaultQueueMaxMsgs = 100000
+
+// Queue of received messages bounded by number of messages and bytes.
+// Ordering of the messages is preserved.
+type logQueue struct {
+	lock     sync.Mutex
+	notEmpty *sync.Cond
+	notFull  *sync.Cond
+
+	maxMsgs  int
+	maxBytes int
+	policy   string
+	spill    *spool
+	// Number of messages which are spilled now (encoded and written without lock)
+	spilling int
+
+	items list.List
+	// FIFO of queued elements per severity, used for drop-by-severity
+	bySeverity [severities]list.List
+	bytes      int
+
+	cancelled bool
+	closed    bool
+	drops     queueDrops
+}
+
+// maxMsgs, maxBytes <= 0 - without limit
+func newLogQueue(maxMsgs, maxBytes int, policy string) *logQueue {
+	q := new(logQueue)
+	q.notEmpty = sync.NewCond(&q.lock)
+	q.notFull = sync.NewCond(&q.lock)
+	q.maxMsgs = maxMsgs
+	q.maxBytes = maxBytes
+	q.policy = policy
+	if len(q.policy) == 0 {
+		q.policy = OverflowBlock
+	}
+	return q
+}
+
+func (q *logQueue) setSpill(sp *spool) {
+	q.lock.Lock()
+	q.spill = sp
+	q.lock.Unlock()
+}
+
+// Puts message to the queue according to overflow policy.
+// Returns false for cancelled queue or discarded message
+func (q *logQueue) put(logParts format.LogParts, size int) bool {
+	item := queued{logParts: logParts, size: size, severity: severityOf(logParts)}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if q.cancelled || q.closed {
+		return false
+	}
+
+	// Keep order: after spill new messages are spilled till
+	// spool becomes empty
+	if (q.spilling > 0) || (q.spill.len() > 0) {
+		return q.spillItem(item)
+	}
+
+	for !q.fits(item) {
+		switch q.policy {
+		case OverflowDropNewest:
+			q.drops.newest.Add(1)
+			return false
+		case OverflowDropOldest:
+			q.remove(q.items.Front())
+			q.drops.oldest.Add(1)
+		case OverflowBySeverity:
+			if !q.shed(item.severity) {
+				q.drops.bySeverity.Add(1)
+				return false
+			}
+			q.drops.bySeverity.Add(1)
+		case OverflowSpill:
+			return q.spillItem(item)
+		default:
+			q.notFull.Wait()
+			if q.cancelled || q.closed {
+				return false
+			}
+		}
+	}
+
+	elem := q.items.PushBack(item)
+	if q.policy == OverflowBySeverity {
+		item.bySeverity = q.bySeverity[item.severity].PushBack(elem)
+		elem.Value = item
+	}
+	q.bytes += item.size
+
+	q.notEmpty.Signal()
+
+	return true
+}
+
+// Returns the oldest message, blocks for empty queue.
+// false - queue was cancelled or closed queue is empty
+func (q *logQueue) get() (queued, bool) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for {
+		if q.cancelled {
+			return queued{}, false
+		}
+
+		if front := q.items.Front(); front != nil {
+			item := front.Value.(queued)
+			q.remove(front)
+			q.notFull.Signal()
+			return item, true
+		}
+
+		if q.closed {
+			return queued{}, false
+		}
+
+		if msg, ok := q.spill.peek(); ok {
+			q.spill.commit()
+			return queued{msg: msg}, true
+		}
+
+		q.notEmpty.Wait()
+	}
+}
+
+// Number of messages and bytes in memory and number of spilled messages
+func (q *logQueue) depth() (msgs int, bytes int, spilled int) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	return q.items.Len(), q.bytes, q.spill.len()
+}
+
+// Returns used part of the limits of the queue [0.0:1.0],
+// 0 for unlimited queue
+func (q *logQueue) saturation() float64 {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	var result float64
+
+	if q.maxMsgs > 0 {
+		result = float64(q.items.Len()) / float64(q.maxMsgs)
+	}
+
+	if q.maxBytes > 0 {
+		if bsat := float64(q.bytes) / float64(q.maxBytes); bsat > result {
+			result = bsat
+		}
+	}
+
+	return result
+}
+
+// Closes the queue: new messages are rejected,
+// messages in memory are still returned by get.
+// Spilled messages stay in the spool for the next start
+func (q *logQueue) close() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.closed = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+func (q *logQueue) cancel() {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.cancelled = true
+	q.notEmpty.Broadcast()
+	q.notFull.Broadcast()
+}
+
+func (q *logQueue) fits(item queued) bool {
+	if q.items.Len() == 0 {
+		return true
+	}
+
+	if (q.maxMsgs > 0) && (q.items.Len() >= q.maxMsgs) {
+		return false
+	}
+
+	if (q.maxBytes > 0) && (q.bytes+item.size > q.maxBytes) {
+		return false
+	}
+
+	return true
+}
+
+// Removes the oldest message with the lowest severity (the highest value).
+// Returns false if all queued messages are more important than received one.
+func (q *logQueue) shed(severity int) bool {
+	for sev := severities - 1; sev > severity; sev-- {
+		if oldest := q.bySeverity[sev].Front(); oldest != nil {
+			q.remove(oldest.Value.(*list.Element))
+			return true
+		}
+	}
+	return false
+}
+
+func (q *logQueue) remove(elem *list.Element) {
+	item := q.items.Remove(elem).(queued)
+
+	if item.bySeverity != nil {
+		q.bySeverity[item.severity].Remove(item.bySeverity)
+	}
+
+	q.bytes -= item.size
+}
+
+// Saves message in the spool. Called under lock, the lock is released
+// for encoding and writing: new messages are spilled while spilling > 0
+func (q *logQueue) spillItem(item queued) bool {
+	if q.spill == nil {
+		q.drops.spill.Add(1)
+		return false
+	}
+
+	sp := q.spill
+	q.spilling++
+	q.lock.Unlock()
+
+	err := spillParts(sp, item.logParts)
+
+	q.lock.Lock()
+	q.spilling--
+
+	if err != nil {
+		q.drops.spill.Add(1)
+		return false
+	}
+
+	q.notEmpty.Signal()
+
+	return true
+}
+
+func spillParts(sp *spool, logParts format.LogParts) error {
+	msg := toMsg(logParts)
+	if msg == nil {
+		return fmt.Errorf("cannot pack message")
+	}
+	setSource(msg, logParts)
+
+	defer Put(msg)
+
+	return sp.put(msg)
+}
+
+// Number of syslog severity levels
+const severities = 8
+
+// Severity of the message, for badly formatted - the lowest one (debug)
+func severityOf(logParts format.LogParts) int {
+	if _, exists := logParts[Formermessage]; exists {
+		return severities - 1
+	}
+
+	severity, exists := logParts[severityKey]
+	if !exists {
+		return severities - 1
+	}
+
+	sevvalue, ok := severity.(int)
+	if !ok || (sevvalue < 0) || (sevvalue >= severities) {
+		return severities - 1
+	}
+
+	return sevvalue
+}
+
+func checkOverflowPolicy(policy string) error {
+	if len(policy) == 0 {
+		return nil
+	}
+	if !isOverflowPolicy(policy) {
+		return fmt.Errorf("wrong overflow policy %s", policy)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package syslogsidecar
+
+import (
+	"testing"
+	"time"
+
+	"github.com/g41797/go-syslog/format"
+)
+
+func testLogParts(severity int, text string) format.LogParts {
+	return format.LogParts{
+		"priority":     8 + severity,
+		"facility":     1,
+		severityKey:    severity,
+		"version":      1,
+		"timestamp":    time.Now(),
+		"hostname":     "host",
+		"app_name":     "app",
+		"proc_id":      "1",
+		"msg_id":       "2",
+		rfc5424OnlyKey: "",
+		"message":      text,
+	}
+}
+
+func getTexts(t *testing.T, q *logQueue, count int) []string {
+	var texts []string
+	for i := 0; i < count; i++ {
+		item, ok := q.get()
+		if !ok {
+			t.Fatalf("get failed")
+		}
+		if item.msg != nil {
+			parts, _ := UnpackToMap(item.msg)
+			texts = append(texts, parts["message"])
+			Put(item.msg)
+			continue
+		}
+		texts = append(texts, item.logParts["message"].(string))
+	}
+	return texts
+}
+
+func checkTexts(t *testing.T, policy string, expected, actual []string) {
+	if len(expected) != len(actual) {
+		t.Fatalf("%s: expected %v actual %v", policy, expected, actual)
+	}
+	for i := range expected {
+		if expected[i] != actual[i] {
+			t.Fatalf("%s: expected %v actual %v", policy, expected, actual)
+		}
+	}
+}
+
+func Test_QueueDropNewestOldest(t *testing.T) {
+	q := newLogQueue(2, 0, OverflowDropNewest)
+	q.put(testLogParts(3, "1"), 1)
+	q.put(testLogParts(3, "2"), 1)
+	if q.put(testLogParts(3, "3"), 1) {
+		t.Errorf("newest message should be dropped")
+	}
+	checkTexts(t, OverflowDropNewest, []string{"1", "2"}, getTexts(t, q, 2))
+
+	q = newLogQueue(0, 10, OverflowDropOldest)
+	q.put(testLogParts(3, "1"), 5)
+	q.put(testLogParts(3, "2"), 5)
+	q.put(testLogParts(3, "3"), 5)
+	checkTexts(t, OverflowDropOldest, []string{"2", "3"}, getTexts(t, q, 2))
+
+	if q.drops.total() != 1 {
+		t.Errorf("expected 1 drop actual %d", q.drops.total())
+	}
+}
+
+func Test_QueueDropBySeverity(t *testing.T) {
+	q := newLogQueue(3, 0, OverflowBySeverity)
+	q.put(testLogParts(7, "debug"), 1)
+	q.put(testLogParts(0, "emerg"), 1)
+	q.put(testLogParts(6, "info"), 1)
+	q.put(testLogParts(3, "err"), 1)
+	q.put(testLogParts(4, "warning"), 1)
+
+	if q.put(testLogParts(7, "debug2"), 1) {
+		t.Errorf("less important message should be dropped")
+	}
+
+	checkTexts(t, OverflowBySeverity, []string{"emerg", "err", "warning"}, getTexts(t, q, 3))
+
+	if q.drops.bySeverity.Load() != 3 {
+		t.Errorf("expected 3 drops actual %d", q.drops.bySeverity.Load())
+	}
+}
+
+func Test_QueueSpill(t *testing.T) {
+	q := newLogQueue(1, 0, OverflowSpill)
+
+	sp, err := openSpool(t.TempDir(), "spill", 0)
+	if err != nil {
+		t.Fatalf("open spool error %v", err)
+	}
+	defer sp.close()
+
+	q.setSpill(sp)
+
+	for _, text := range []string{"1", "2", "3"} {
+		if !q.put(testLogParts(3, text), 1) {
+			t.Fatalf("put failed")
+		}
+	}
+
+	checkTexts(t, OverflowSpill, []string{"1", "2"}, getTexts(t, q, 2))
+
+	q.put(testLogParts(3, "4"), 1)
+
+	checkTexts(t, OverflowSpill, []string{"3", "4"}, getTexts(t, q, 2))
+}
+
+func Test_QueueBlock(t *testing.T) {
+	q := newLogQueue(1, 0, OverflowBlock)
+	q.put(testLogParts(3, "1"), 1)
+
+	done := make(chan bool)
+	go func() {
+		done <- q.put(testLogParts(3, "2"), 1)
+	}()
+
+	select {
+	case <-done:
+		t.Fatalf("put to full queue should block")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	checkTexts(t, OverflowBlock, []string{"1"}, getTexts(t, q, 1))
+
+	if !<-done {
+		t.Fatalf("blocked put failed")
+	}
+
+	q.cancel()
+
+	if _, ok := q.get(); ok {
+		t.Errorf("get from cancelled queue should fail")
+	}
+}
+
+func Test_QueueClose(t *testing.T) {
+	q := newLogQueue(0, 0, OverflowBlock)
+	q.put(testLogParts(3, "1"), 1)
+	q.put(testLogParts(3, "2"), 1)
+
+	q.close()
+
+	if q.put(testLogParts(3, "3"), 1) {
+		t.Errorf("put to closed queue should fail")
+	}
+
+	checkTexts(t, "close", []string{"1", "2"}, getTexts(t, q, 2))
+
+	if _, ok := q.get(); ok {
+		t.Errorf("get from empty closed queue should fail")
+	}
+}
+
+func Test_QueueDefaultLimit(t *testing.T) {
+	if maxMsgs := newServer(SyslogConfiguration{}).q.maxMsgs; maxMsgs != defaultQueueMaxMsgs {
+		t.Errorf("expected default limit %d actual %d", defaultQueueMaxMsgs, maxMsgs)
+	}
+
+	if maxMsgs := newServer(SyslogConfiguration{QUEUE_MAXMSGS: -1}).q.maxMsgs; maxMsgs > 0 {
+		t.Errorf("expected unlimited queue actual %d", maxMsgs)
+	}
+}
@@ -0,0 +1,378 @@
+package syslogsidecar
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/g41797/go-syslog/format"
+)
+
+//
+// Minimal implementation of Prometheus text exposition format
+// https://prometheus.io/docs/instrumenting/exposition_formats/
+//
+
+type metric interface {
+	write(w io.Writer)
+}
+
+type metricsRegistry struct {
+	lock    sync.Mutex
+	metrics []metric
+}
+
+func (reg *metricsRegistry) register(m metric) {
+	reg.lock.Lock()
+	defer reg.lock.Unlock()
+	reg.metrics = append(reg.metrics, m)
+}
+
+func (reg *metricsRegistry) write(w io.Writer) {
+	reg.lock.Lock()
+	metrics := append([]metric(nil), reg.metrics...)
+	reg.lock.Unlock()
+
+	for _, m := range metrics {
+		m.write(w)
+	}
+}
+
+// Serves /metrics
+func (reg *metricsRegistry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	reg.write(w)
+}
+
+var registry = new(metricsRegistry)
+
+// Counter with labels
+type counterVec struct {
+	name   string
+	help   string
+	labels []string
+	values sync.Map // joined label values -> *atomic.Uint64
+}
+
+func newCounterVec(name, help string, labels ...string) *counterVec {
+	cv := &counterVec{name: name, help: help, labels: labels}
+	registry.register(cv)
+	return cv
+}
+
+func (cv *counterVec) add(n uint64, lvalues ...string) {
+	key := strings.Join(lvalues, "\x00")
+
+	val, ok := cv.values.Load(key)
+	if !ok {
+		val, _ = cv.values.LoadOrStore(key, new(atomic.Uint64))
+	}
+
+	val.(*atomic.Uint64).Add(n)
+}
+
+func (cv *counterVec) inc(lvalues ...string) {
+	cv.add(1, lvalues...)
+}
+
+// Returns current value, used by tests and health checks
+func (cv *counterVec) value(lvalues ...string) uint64 {
+	val, ok := cv.values.Load(strings.Join(lvalues, "\x00"))
+	if !ok {
+		return 0
+	}
+	return val.(*atomic.Uint64).Load()
+}
+
+func (cv *counterVec) write(w io.Writer) {
+	writeHeader(w, cv.name, cv.help, "counter")
+
+	values := make(map[string]*atomic.Uint64)
+	cv.values.Range(func(key, val any) bool {
+		values[key.(string)] = val.(*atomic.Uint64)
+		return true
+	})
+
+	for _, key := range sortedKeys(values) {
+		writeSample(w, cv.name, cv.labels, splitKey(key), "", "", float64(values[key].Load()))
+	}
+}
+
+// Histogram with labels
+type histogramVec struct {
+	name    string
+	help    string
+	labels  []string
+	buckets []float64
+	values  sync.Map // joined label values -> *histogram
+}
+
+type histogram struct {
+	lock   sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogramVec(name, help string, buckets []float64, labels ...string) *histogramVec {
+	hv := &histogramVec{name: name, help: help, buckets: buckets, labels: labels}
+	registry.register(hv)
+	return hv
+}
+
+func (hv *histogramVec) observe(v float64, lvalues ...string) {
+	key := strings.Join(lvalues, "\x00")
+
+	val, ok := hv.values.Load(key)
+	if !ok {
+		val, _ = hv.values.LoadOrStore(key, &histogram{counts: make([]uint64, len(hv.buckets))})
+	}
+
+	h := val.(*histogram)
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for i, bound := range hv.buckets {
+		if v <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+func (hv *histogramVec) write(w io.Writer) {
+	writeHeader(w, hv.name, hv.help, "histogram")
+
+	values := make(map[string]*histogram)
+	hv.values.Range(func(key, val any) bool {
+		values[key.(string)] = val.(*histogram)
+		return true
+	})
+
+	for _, key := range sortedKeys(values) {
+		h := values[key]
+		lvalues := splitKey(key)
+
+		h.lock.Lock()
+		for i, bound := range hv.buckets {
+			writeSample(w, hv.name+"_bucket", hv.labels, lvalues, "le", formatFloat(bound), float64(h.counts[i]))
+		}
+		writeSample(w, hv.name+"_bucket", hv.labels, lvalues, "le", "+Inf", float64(h.count))
+		writeSample(w, hv.name+"_sum", hv.labels, lvalues, "", "", h.sum)
+		writeSample(w, hv.name+"_count", hv.labels, lvalues, "", "", float64(h.count))
+		h.lock.Unlock()
+	}
+}
+
+// Source of collected values, reports every value via callback
+type collector func(report func(val float64, lvalues ...string))
+
+// Gauge (or counter) with values collected during scrape
+type collectedVec struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	lock    sync.Mutex
+	sources []collector
+}
+
+func newGaugeVec(name, help string, labels ...string) *collectedVec {
+	cv := &collectedVec{name: name, help: help, kind: "gauge", labels: labels}
+	registry.register(cv)
+	return cv
+}
+
+func newCollectedCounterVec(name, help string, labels ...string) *collectedVec {
+	cv := newGaugeVec(name, help, labels...)
+	cv.kind = "counter"
+	return cv
+}
+
+// Adds source of values
+func (cv *collectedVec) collect(source collector) {
+	cv.lock.Lock()
+	defer cv.lock.Unlock()
+	cv.sources = append(cv.sources, source)
+}
+
+// Removes all sources, e.g. after stop of the server
+func (cv *collectedVec) reset() {
+	cv.lock.Lock()
+	defer cv.lock.Unlock()
+	cv.sources = nil
+}
+
+func (cv *collectedVec) write(w io.Writer) {
+	cv.lock.Lock()
+	sources := append([]collector(nil), cv.sources...)
+	cv.lock.Unlock()
+
+	writeHeader(w, cv.name, cv.help, cv.kind)
+
+	for _, source := range sources {
+		source(func(val float64, lvalues ...string) {
+			writeSample(w, cv.name, cv.labels, lvalues, "", "", val)
+		})
+	}
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	fmt.Fprintf(w, "# HELP %s %s\n", name, help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, kind)
+}
+
+// Writes quoted label value escaped according to Prometheus text format:
+// only backslash, double quote and line feed are escaped,
+// invalid UTF-8 is replaced
+func writeLabelValue(sb *strings.Builder, val string) {
+	val = strings.ToValidUTF8(val, "\uFFFD")
+
+	sb.WriteByte('"')
+	for i := 0; i < len(val); i++ {
+		switch c := val[i]; c {
+		case '\\':
+			sb.WriteString(`\\`)
+		case '"':
+			sb.WriteString(`\"`)
+		case '\n':
+			sb.WriteString(`\n`)
+		default:
+			sb.WriteByte(c)
+		}
+	}
+	sb.WriteByte('"')
+}
+
+func writeSample(w io.Writer, name string, labels, lvalues []string, extraLabel, extraValue string, val float64) {
+	var sb strings.Builder
+
+	sb.WriteString(name)
+
+	sep := byte('{')
+
+	for i, label := range labels {
+		if i >= len(lvalues) {
+			break
+		}
+		sb.WriteByte(sep)
+		sb.WriteString(label)
+		sb.WriteString("=")
+		writeLabelValue(&sb, lvalues[i])
+		sep = ','
+	}
+
+	if len(extraLabel) > 0 {
+		sb.WriteByte(sep)
+		sb.WriteString(extraLabel)
+		sb.WriteString("=")
+		writeLabelValue(&sb, extraValue)
+		sep = ','
+	}
+
+	if sep == ',' {
+		sb.WriteByte('}')
+	}
+
+	sb.WriteByte(' ')
+	sb.WriteString(formatFloat(val))
+	sb.WriteByte('\n')
+
+	io.WriteString(w, sb.String())
+}
+
+func formatFloat(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func splitKey(key string) []string {
+	return strings.Split(key, "\x00")
+}
+
+// Metrics of the pipeline
+var (
+	mReceived = newCounterVec("syslogsidecar_received_total",
+		"Received syslog messages", "listener", "format")
+	mFiltered = newCounterVec("syslogsidecar_filtered_total",
+		"Messages discarded according to SEVERITYLEVEL", "listener", "format")
+	mMessageSize = newHistogramVec("syslogsidecar_message_size_bytes",
+		"Size of received syslog messages",
+		[]float64{64, 128, 256, 512, 1024, 2048, 4096, 8192, 16384, 65536}, "listener", "format")
+
+	mQueueDepth = newGaugeVec("syslogsidecar_queue_messages",
+		"Messages in the queue of received messages", "place")
+	mQueueBytes = newGaugeVec("syslogsidecar_queue_bytes",
+		"Size of messages in memory queue of received messages")
+	mQueueDropped = newCollectedCounterVec("syslogsidecar_queue_dropped_total",
+		"Messages discarded by overflow policy of the queue", "reason")
+	mUDPKernelDrops = newCollectedCounterVec("syslogsidecar_udp_kernel_drops_total",
+		"Datagrams dropped by the kernel for UDP socket (see /proc/net/udp)", "listener", "socket")
+	mProxyHeaders = newCounterVec("syslogsidecar_proxy_headers_total",
+		"Results of processing of PROXY protocol headers", "listener", "outcome")
+	mConnections = newGaugeVec("syslogsidecar_connections",
+		"Open TCP and TLS connections", "listener")
+	mConnectionsRejected = newCounterVec("syslogsidecar_connections_rejected_total",
+		"TCP and TLS connections closed because of limits of connections", "listener", "reason")
+	mConnectionsIdleClosed = newCounterVec("syslogsidecar_connections_idle_closed_total",
+		"TCP and TLS connections closed because of idle timeout", "listener")
+	mTruncated = newCounterVec("syslogsidecar_truncated_total",
+		"Messages truncated because of MAX_MESSAGE_SIZE", "listener")
+	mAccessRejected = newCounterVec("syslogsidecar_access_rejected_total",
+		"UDP packets and TCP/TLS connections rejected by access control list", "listener")
+
+	mProduced = newCounterVec("syslogsidecar_produce_total",
+		"Results of producing of messages", "producer", "target", "outcome")
+	mProduceDuration = newHistogramVec("syslogsidecar_produce_duration_seconds",
+		"Duration of Produce including retries",
+		[]float64{0.0005, 0.001, 0.005, 0.01, 0.05, 0.1, 0.5, 1, 5, 10}, "producer")
+	mProducerChannels = newGaugeVec("syslogsidecar_producer_channel_messages",
+		"Messages waiting in channels of producer workers", "producer")
+	mSpool = newGaugeVec("syslogsidecar_spool_messages",
+		"Messages in the disk spool of the producer", "producer")
+	mBreaker = newGaugeVec("syslogsidecar_breaker_state",
+		"State of circuit breaker of the producer: 0 - closed, 1 - open, 2 - half-open", "producer")
+
+	mRedactions = newCounterVec("syslogsidecar_redactions_total",
+		"Redacted fragments of messages", "rule", "part")
+	mRateLimited = newCounterVec("syslogsidecar_ratelimited_total",
+		"Messages dropped by rate limits", "severity")
+	mSampledOut = newCounterVec("syslogsidecar_sampled_out_total",
+		"Messages dropped by sampling", "rule")
+	mParsed = newCounterVec("syslogsidecar_parsed_total",
+		"Results of parsing of payloads of messages", "parser", "outcome")
+	mTimestampReplaced = newCounterVec("syslogsidecar_timestamp_replaced_total",
+		"Timestamps replaced by the time of receiving because of clock skew of the sender", "listener")
+)
+
+// Outcomes of producing
+const (
+	outcomeProduced  = "produced"
+	outcomeFailed    = "failed"
+	outcomeSpooled   = "spooled"
+	outcomeWriter    = "writer"
+	outcomeDiscarded = "discarded"
+)
+
+// Format label of received message
+func formatOf(logParts format.LogParts) string {
+	if _, exists := logParts[Formermessage]; exists {
+		return Formermessage
+	}
+	if _, exists := logParts[rfc5424OnlyKey]; exists {
+		return rfc5424
+	}
+	if _, exists := logParts[rfc3164OnlyKey]; exists {
+		return rfc3164
+	}
+	return Formermessage
+}
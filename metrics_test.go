@@ -0,0 +1,127 @@
+package syslogsidecar
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/g41797/kissngoqueue"
+	"github.com/g41797/sputnik"
+)
+
+func Test_MetricsFormat(t *testing.T) {
+	var buf bytes.Buffer
+
+	cv := &counterVec{name: "test_total", help: "Test counter", labels: []string{"a", "b"}}
+	cv.add(2, "x", "y\"z")
+	cv.inc("x", "y\"z")
+	cv.write(&buf)
+
+	hv := &histogramVec{name: "test_size", help: "Test histogram", buckets: []float64{10, 100}}
+	hv.observe(5)
+	hv.observe(50)
+	hv.write(&buf)
+
+	expected := []string{
+		"# TYPE test_total counter",
+		`test_total{a="x",b="y\"z"} 3`,
+		"# TYPE test_size histogram",
+		`test_size_bucket{le="10"} 1`,
+		`test_size_bucket{le="100"} 2`,
+		`test_size_bucket{le="+Inf"} 2`,
+		"test_size_sum 55",
+		"test_size_count 2",
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(buf.String(), line) {
+			t.Errorf("%s not found in\n%s", line, buf.String())
+		}
+	}
+}
+
+func Test_LabelValueEscaping(t *testing.T) {
+	for _, tc := range []struct {
+		val      string
+		expected string
+	}{
+		{`host\a`, `"host\\a"`},
+		{"line\nbreak", `"line\nbreak"`},
+		{"tab\tand \"quote\"", "\"tab\tand \\\"quote\\\"\""},
+		{"хост-é", `"хост-é"`},
+		{"bad\xffutf8", "\"bad\uFFFDutf8\""},
+	} {
+		var sb strings.Builder
+		writeLabelValue(&sb, tc.val)
+
+		if sb.String() != tc.expected {
+			t.Errorf("%q: expected %s actual %s", tc.val, tc.expected, sb.String())
+		}
+	}
+}
+
+func Test_MetricsEndpoint(t *testing.T) {
+	conf := defaultServerConfiguration()
+	conf.ADDRHTTP = "127.0.0.1:9514"
+
+	srv := newServer(conf)
+
+	if err := srv.initServer(); err != nil {
+		t.Fatalf("Init error %v", err)
+	}
+
+	q := kissngoqueue.NewQueue[sputnik.Msg]()
+	srv.setupHandling(newCommunicator(q))
+
+	if err := srv.start(); err != nil {
+		t.Fatalf("Start syslogd error %v", err)
+	}
+
+	defer srv.stop()
+
+	listener := listenerName("tcp", conf.ADDRTCP)
+	before := mReceived.value(listener, rfc5424)
+
+	cl := newClient()
+	if err := cl.init(); err != nil {
+		t.Fatalf("Init client error %v", err)
+	}
+	defer cl.finish()
+
+	if err := cl.log("metrics"); err != nil {
+		t.Fatalf("send log message error %v", err)
+	}
+
+	msg, ok := q.Get()
+	if !ok {
+		t.Fatalf("failed receive from test queue")
+	}
+	Put(msg)
+
+	if after := mReceived.value(listener, rfc5424); after != before+1 {
+		t.Errorf("Expected %d received messages, actual %d", before+1, after)
+	}
+
+	resp, err := http.Get("http://" + conf.ADDRHTTP + "/metrics")
+	if err != nil {
+		t.Fatalf("get metrics error %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(resp.Body)
+
+	expected := []string{
+		`syslogsidecar_received_total{listener="tcp/127.0.0.1:5141",format="RFC5424"}`,
+		`syslogsidecar_message_size_bytes_count{listener="tcp/127.0.0.1:5141",format="RFC5424"}`,
+		`syslogsidecar_queue_messages{place="memory"} 0`,
+		`syslogsidecar_queue_dropped_total{reason="drop-newest"} 0`,
+	}
+
+	for _, line := range expected {
+		if !strings.Contains(string(body), line) {
+			t.Errorf("%s not found in\n%s", line, body)
+		}
+	}
+}
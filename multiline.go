@@ -0,0 +1,218 @@
+package syslogsidecar
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/g41797/sputnik"
+)
+
+// Name of multi-line reassembly processor and its configuration (multiline.json)
+const MultilineName = "multiline"
+
+// Configuration of multi-line reassembly processor is stored in multiline.json.
+// Exactly one of START_PATTERN and CONTINUE_PATTERN should be used.
+// Patterns are matched against parsed text of the line: leading spaces
+// of RFC3164 content are trimmed by the parser (tabs are kept)
+type MultilineConfiguration struct {
+	// Regular expression of the first line of the message, e.g. "^\\d{4}-\\d{2}-\\d{2} ".
+	// Lines which do not match the pattern are continuation lines
+	START_PATTERN string
+
+	// Regular expression of continuation lines, e.g. "^\\s*at \\S+\\(|^Caused by:|^\\.\\.\\. \\d+ more".
+	// Only lines which match the pattern are continuation lines
+	CONTINUE_PATTERN string
+
+	// Combined message is sent if the next line was not received
+	// during TIMEOUT_MS milliseconds (default 1000)
+	TIMEOUT_MS int
+
+	// Max number of lines of combined message (default 500)
+	MAX_LINES int
+
+	// Separator of lines of combined message (default "\n")
+	JOIN string
+
+	// Reassembly is used only for messages of the applications (app_name, for RFC3164 - tag).
+	// Empty - all applications
+	APP_NAMES []string
+}
+
+// Extra part of combined message with number of lines
+const LinesPart = "multiline_lines"
+
+// Message under reassembly, key - hostname and app name
+type multilineEntry struct {
+	first    sputnik.Msg
+	parts    map[string]string
+	textPart string
+	lines    []string
+	seen     time.Time
+}
+
+type multilineAssembler struct {
+	conf    MultilineConfiguration
+	start   *regexp.Regexp
+	cont    *regexp.Regexp
+	timeout time.Duration
+	apps    map[string]bool
+	lock    sync.Mutex
+	pending map[string]*multilineEntry
+	now     func() time.Time
+}
+
+func newMultilineAssembler() Processor {
+	return &multilineAssembler{pending: make(map[string]*multilineEntry), now: time.Now}
+}
+
+func init() {
+	RegisterProcessorFactory(MultilineName, newMultilineAssembler)
+}
+
+func (ma *multilineAssembler) Init(cf sputnik.ConfFactory) error {
+	if err := readProcessorConfiguration(cf, MultilineName, &ma.conf); err != nil {
+		return err
+	}
+
+	if len(ma.conf.START_PATTERN)+len(ma.conf.CONTINUE_PATTERN) == 0 {
+		return fmt.Errorf("START_PATTERN or CONTINUE_PATTERN should be used")
+	}
+
+	if (len(ma.conf.START_PATTERN) > 0) && (len(ma.conf.CONTINUE_PATTERN) > 0) {
+		return fmt.Errorf("only one of START_PATTERN and CONTINUE_PATTERN should be used")
+	}
+
+	var err error
+
+	if len(ma.conf.START_PATTERN) > 0 {
+		if ma.start, err = regexp.Compile(ma.conf.START_PATTERN); err != nil {
+			return fmt.Errorf("wrong START_PATTERN: %v", err)
+		}
+	}
+
+	if len(ma.conf.CONTINUE_PATTERN) > 0 {
+		if ma.cont, err = regexp.Compile(ma.conf.CONTINUE_PATTERN); err != nil {
+			return fmt.Errorf("wrong CONTINUE_PATTERN: %v", err)
+		}
+	}
+
+	ma.timeout = time.Second
+	if ma.conf.TIMEOUT_MS > 0 {
+		ma.timeout = time.Duration(ma.conf.TIMEOUT_MS) * time.Millisecond
+	}
+
+	if ma.conf.MAX_LINES <= 0 {
+		ma.conf.MAX_LINES = 500
+	}
+
+	if len(ma.conf.JOIN) == 0 {
+		ma.conf.JOIN = "\n"
+	}
+
+	ma.apps = toSet(ma.conf.APP_NAMES)
+
+	return nil
+}
+
+func (ma *multilineAssembler) Process(msg sputnik.Msg) []sputnik.Msg {
+	parts, err := UnpackToMap(msg)
+	if err != nil {
+		return []sputnik.Msg{msg}
+	}
+
+	appName, exists := parts["app_name"]
+	if !exists {
+		appName = parts[rfc3164OnlyKey]
+	}
+
+	if (len(ma.apps) > 0) && !ma.apps[appName] {
+		return []sputnik.Msg{msg}
+	}
+
+	textPart := messagePartOf(parts)
+	text := parts[textPart]
+	key := parts["hostname"] + "\x00" + appName
+
+	ma.lock.Lock()
+	defer ma.lock.Unlock()
+
+	entry, exists := ma.pending[key]
+
+	if ma.isContinuation(text) {
+		if !exists {
+			// Continuation without the first line
+			return []sputnik.Msg{msg}
+		}
+
+		entry.lines = append(entry.lines, text)
+		entry.seen = ma.now()
+		Put(msg)
+
+		if len(entry.lines) < ma.conf.MAX_LINES {
+			return nil
+		}
+
+		delete(ma.pending, key)
+		return ma.combine(entry)
+	}
+
+	var result []sputnik.Msg
+
+	if exists {
+		result = ma.combine(entry)
+	}
+
+	ma.pending[key] = &multilineEntry{
+		first:    msg,
+		parts:    parts,
+		textPart: textPart,
+		lines:    []string{text},
+		seen:     ma.now(),
+	}
+
+	return result
+}
+
+// Sends combined messages without continuation lines during the timeout
+func (ma *multilineAssembler) Flush(final bool) []sputnik.Msg {
+	now := ma.now()
+
+	ma.lock.Lock()
+	defer ma.lock.Unlock()
+
+	var result []sputnik.Msg
+
+	for key, entry := range ma.pending {
+		if final || (now.Sub(entry.seen) >= ma.timeout) {
+			result = append(result, ma.combine(entry)...)
+			delete(ma.pending, key)
+		}
+	}
+
+	return result
+}
+
+func (ma *multilineAssembler) isContinuation(text string) bool {
+	if ma.cont != nil {
+		return ma.cont.MatchString(text)
+	}
+	return !ma.start.MatchString(text)
+}
+
+// Returns the first message with joined lines
+func (ma *multilineAssembler) combine(entry *multilineEntry) []sputnik.Msg {
+	if len(entry.lines) == 1 {
+		return []sputnik.Msg{entry.first}
+	}
+
+	entry.parts[entry.textPart] = strings.Join(entry.lines, ma.conf.JOIN)
+	entry.parts[LinesPart] = strconv.Itoa(len(entry.lines))
+
+	Pack(entry.first, entry.parts)
+
+	return []sputnik.Msg{entry.first}
+}
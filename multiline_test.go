@@ -0,0 +1,151 @@
+package syslogsidecar
+
+import (
+	"errors"
+	"io/fs"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/g41797/sputnik"
+	"github.com/g41797/sputnik/sidecar"
+)
+
+// Packs RFC3164 message of the host with the content,
+// content should be trimmed as by the parser
+func lineMsg(hostname string, content string) sputnik.Msg {
+	parts := makeRFC3164Msg()
+	parts["hostname"] = hostname
+	parts[rfc3164OnlyKey] = "java"
+	parts["content"] = content
+
+	msg := Get()
+	Pack(msg, parts)
+	return msg
+}
+
+func Test_Multiline(t *testing.T) {
+	conf := MultilineConfiguration{
+		CONTINUE_PATTERN: `^\s*at \S+\(|^Caused by:`,
+		TIMEOUT_MS:       500,
+		MAX_LINES:        4,
+	}
+
+	prc := newMultilineAssembler()
+	if err := prc.Init(testConfFactory(MultilineName, conf)); err != nil {
+		t.Fatalf("Init error %v", err)
+	}
+
+	ma := prc.(*multilineAssembler)
+	now := time.Now()
+	ma.now = func() time.Time { return now }
+
+	var out []sputnik.Msg
+
+	for _, line := range []struct{ host, content string }{
+		{"h1", "Exception in thread main"},
+		{"h2", "at orphan.line()"},
+		{"h1", "at com.example.A(A.java:10)"},
+		{"h2", "started"},
+		{"h1", "Caused by: java.io.IOException"},
+		{"h1", "next message"},
+	} {
+		out = append(out, prc.Process(lineMsg(line.host, line.content))...)
+	}
+
+	if len(out) != 2 {
+		t.Fatalf("expected 2 messages actual %d", len(out))
+	}
+
+	checkPart(t, out[0], "content", "at orphan.line()", true)
+	checkPart(t, out[1], "content", "Exception in thread main\nat com.example.A(A.java:10)\nCaused by: java.io.IOException", true)
+	checkPart(t, out[1], LinesPart, "3", true)
+
+	for _, msg := range out {
+		Put(msg)
+	}
+
+	if flushed := ma.Flush(false); len(flushed) != 0 {
+		t.Fatalf("flush before timeout")
+	}
+
+	now = now.Add(time.Second)
+
+	flushed := ma.Flush(false)
+	if len(flushed) != 2 {
+		t.Fatalf("expected 2 flushed messages actual %d", len(flushed))
+	}
+
+	for _, msg := range flushed {
+		checkPart(t, msg, LinesPart, "", false)
+		Put(msg)
+	}
+
+	// MAX_LINES
+	prc.Process(lineMsg("h3", "first"))
+	for i := 0; i < 2; i++ {
+		if out = prc.Process(lineMsg("h3", "at line()")); len(out) != 0 {
+			t.Fatalf("line %d should be combined", i)
+		}
+	}
+
+	out = prc.Process(lineMsg("h3", "at line()"))
+	if len(out) != 1 {
+		t.Fatalf("message with MAX_LINES should be sent")
+	}
+	checkPart(t, out[0], LinesPart, "4", true)
+	Put(out[0])
+
+	if err := newMultilineAssembler().Init(testConfFactory(MultilineName, MultilineConfiguration{})); err == nil {
+		t.Errorf("configuration without patterns should fail")
+	}
+}
+
+// Pending message is sent to the producer on stop of the receiver
+func Test_MultilineOnStop(t *testing.T) {
+	conf := MultilineConfiguration{CONTINUE_PATTERN: `^\s+at `, TIMEOUT_MS: 60000}
+
+	texts := receiveAndStop(t, MultilineName, conf, []string{
+		"<134>1 2003-10-11T22:14:15.003Z mymachine java - - - Exception in thread main",
+		"<134>1 2003-10-11T22:14:15.004Z mymachine java - - -   at com.example.A(A.java:10)",
+	})
+
+	if len(texts) != 1 || texts[0] != "Exception in thread main\n  at com.example.A(A.java:10)" {
+		t.Errorf("wrong messages %q", texts)
+	}
+}
+
+// Leading spaces of RFC3164 content are trimmed by the parser
+func Test_MultilineRFC3164(t *testing.T) {
+	conf := MultilineConfiguration{CONTINUE_PATTERN: `^\s*at \S+\(|^Caused by:`, TIMEOUT_MS: 60000}
+
+	texts := receiveAndStop(t, MultilineName, conf, []string{
+		"<134>Oct 11 22:14:15 mymachine java: Exception in thread main",
+		"<134>Oct 11 22:14:15 mymachine java:     at com.example.A(A.java:10)",
+		"<134>Oct 11 22:14:15 mymachine java: \tat com.example.B(B.java:20)",
+		"<134>Oct 11 22:14:15 mymachine java: Caused by: java.io.IOException",
+		"<134>Oct 11 22:14:16 mymachine java: at noon",
+	})
+
+	expected := []string{
+		"Exception in thread main\nat com.example.A(A.java:10)\n\tat com.example.B(B.java:20)\nCaused by: java.io.IOException",
+		"at noon",
+	}
+
+	if !reflect.DeepEqual(texts, expected) {
+		t.Errorf("expected %q actual %q", expected, texts)
+	}
+}
+
+func Test_MultilineConfiguration(t *testing.T) {
+	// Missing multiline.json - patterns are not configured
+	err := newMultilineAssembler().Init(sidecar.ConfigFactory(t.TempDir()))
+	if err == nil || errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("expected error of missing patterns actual %v", err)
+	}
+
+	conf := MultilineConfiguration{START_PATTERN: `^\S`, CONTINUE_PATTERN: `^\s+at `}
+	if err = newMultilineAssembler().Init(testConfFactory(MultilineName, conf)); err == nil {
+		t.Errorf("both patterns should fail")
+	}
+}
@@ -0,0 +1,474 @@
+package syslogsidecar
+
+import (
+	"fmt"
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/g41797/sputnik"
+	"github.com/g41797/sputnik/sidecar"
+)
+
+// Name of the message key with name of the producer
+const producerKey = "producer"
+
+// Broker specific producer with own configuration,
+// retry policy, circuit breaker, spool and workers
+type namedProducer struct {
+	// Empty for default producer
+	name      string
+	conf      ProducerConfiguration
+	mp        sidecar.MessageProducer
+	connected atomic.Bool
+	writer    sputnik.BlockCommunicator
+	retry     retryPolicy
+	breaker   *circuitBreaker
+	spool     *spool
+	stop      chan struct{}
+
+	// Time of disconnection in nanoseconds since epoch, 0 - connected
+	disconnectedAt atomic.Int64
+
+	// Message channel per worker
+	mlogs   []chan sputnik.Msg
+	workers sync.WaitGroup
+
+	// Protects MessageProducer: Produce is called under read lock,
+	// Connect and Disconnect - under write lock
+	mpLock sync.RWMutex
+
+	// Only one goroutine produces spooled messages
+	drainLock sync.Mutex
+}
+
+func newNamedProducer(name string, mp sidecar.MessageProducer) *namedProducer {
+	np := new(namedProducer)
+	np.name = name
+	np.mp = mp
+	return np
+}
+
+// Returns name of configuration of named producer, e.g.
+// syslogproducer_file for producer "file"
+func (np *namedProducer) confName(name string) string {
+	if len(np.name) == 0 {
+		return name
+	}
+	return name + "_" + np.name
+}
+
+// Configuration factory for broker specific producer
+func (np *namedProducer) confFactory(fact sputnik.ConfFactory) sputnik.ConfFactory {
+	if len(np.name) == 0 {
+		return fact
+	}
+
+	return func(confName string, result any) error {
+		return fact(np.confName(confName), result)
+	}
+}
+
+func (np *namedProducer) receivesUnqualified() bool {
+	return unqualifiedReceiver(np.name)
+}
+
+func (np *namedProducer) init(fact sputnik.ConfFactory) error {
+	confName := np.confName(ProducerName)
+
+	if err := readProducerConfiguration(fact, confName, &np.conf); err != nil {
+		return err
+	}
+
+	np.retry = newRetryPolicy(np.conf)
+	np.breaker = newCircuitBreaker(np.conf.BREAKER_FAILURES, time.Duration(np.conf.BREAKER_OPEN_MS)*time.Millisecond)
+
+	if np.conf.READY_DISCONNECTED_MS <= 0 {
+		np.conf.READY_DISCONNECTED_MS = 30000
+	}
+
+	if np.conf.READY_SPOOL_RATIO <= 0 {
+		np.conf.READY_SPOOL_RATIO = 0.9
+	}
+
+	np.disconnectedAt.Store(time.Now().UnixNano())
+
+	if np.conf.WORKERS < 1 {
+		np.conf.WORKERS = 1
+	}
+
+	switch np.conf.PARTITION_KEY {
+	case "":
+		np.conf.PARTITION_KEY = PartitionByHostname
+	case PartitionByHostname, PartitionByAppName, PartitionByTarget:
+	default:
+		return fmt.Errorf("wrong partition key %s", np.conf.PARTITION_KEY)
+	}
+
+	if len(np.conf.SPOOL_PATH) > 0 {
+		sp, err := openSpool(np.conf.SPOOL_PATH, confName, np.conf.SPOOL_MAXMSGS)
+		if err != nil {
+			return err
+		}
+		np.spool = sp
+	}
+
+	np.mlogs = make([]chan sputnik.Msg, np.conf.WORKERS)
+	for i := range np.mlogs {
+		np.mlogs[i] = make(chan sputnik.Msg, 1)
+	}
+
+	return nil
+}
+
+func (np *namedProducer) start(writer sputnik.BlockCommunicator, stop chan struct{}) {
+	np.writer = writer
+	np.stop = stop
+
+	for _, mlog := range np.mlogs {
+		np.workers.Add(1)
+		go np.work(mlog)
+	}
+
+	np.collectMetrics()
+
+	health.add(np.healthOwner(), false, np.checkReadiness)
+}
+
+func (np *namedProducer) healthOwner() string {
+	return "producer " + np.label()
+}
+
+// Readiness: producer is connected or disconnected for short time,
+// spool is not near capacity
+func (np *namedProducer) checkReadiness() []checkResult {
+	conn := checkResult{Name: np.healthOwner(), Ok: true, Status: "connected"}
+
+	if since := np.disconnectedAt.Load(); since != 0 {
+		disconnected := time.Since(time.Unix(0, since))
+		conn.Ok = disconnected < time.Duration(np.conf.READY_DISCONNECTED_MS)*time.Millisecond
+		conn.Status = fmt.Sprintf("disconnected for %s", disconnected.Round(time.Second))
+	}
+
+	results := []checkResult{conn}
+
+	if np.spool == nil {
+		return results
+	}
+
+	backlog := np.spool.len()
+	capacity := np.spool.capacity()
+
+	spl := checkResult{Name: "spool " + np.label(), Ok: true, Status: fmt.Sprintf("%d messages", backlog)}
+
+	if capacity > 0 {
+		spl.Ok = float64(backlog) < np.conf.READY_SPOOL_RATIO*float64(capacity)
+		spl.Status = fmt.Sprintf("%d of %d messages", backlog, capacity)
+	}
+
+	return append(results, spl)
+}
+
+// Name of the producer for labels of the metrics
+func (np *namedProducer) label() string {
+	if len(np.name) == 0 {
+		return "default"
+	}
+	return np.name
+}
+
+func (np *namedProducer) collectMetrics() {
+	label := np.label()
+
+	mProducerChannels.collect(func(report func(val float64, lvalues ...string)) {
+		waiting := 0
+		for _, mlog := range np.mlogs {
+			waiting += len(mlog)
+		}
+		report(float64(waiting), label)
+	})
+
+	mSpool.collect(func(report func(val float64, lvalues ...string)) {
+		report(float64(np.spool.len()), label)
+	})
+
+	mBreaker.collect(func(report func(val float64, lvalues ...string)) {
+		report(float64(np.breaker.current()), label)
+	})
+}
+
+// Returns targets of the message for labels of the metrics.
+// Should be called before Produce - message may be reused by the producer
+func (np *namedProducer) targetsOf(logmsg sputnik.Msg) []string {
+	targets, err := Targets(logmsg)
+	if (err != nil) || (len(targets) == 0) {
+		return []string{""}
+	}
+	return targets
+}
+
+func (np *namedProducer) count(outcome string, targets []string) {
+	for _, target := range targets {
+		mProduced.inc(np.label(), target, outcome)
+	}
+}
+
+// Waits finish of the workers and disconnects
+func (np *namedProducer) finish() {
+	np.workers.Wait()
+
+	np.mpLock.Lock()
+	np.mp.Disconnect()
+	np.setConnected(false)
+	np.mpLock.Unlock()
+
+	np.spool.close()
+}
+
+func (np *namedProducer) connect(fact sputnik.ConfFactory, sharedconn sputnik.ServerConnection) {
+	np.mpLock.Lock()
+	err := np.mp.Connect(np.confFactory(fact), sharedconn)
+	np.setConnected(err == nil)
+	np.mpLock.Unlock()
+
+	np.drainSpool()
+}
+
+func (np *namedProducer) disconnect() {
+	np.mpLock.Lock()
+	defer np.mpLock.Unlock()
+
+	if np.connected.Load() {
+		np.mp.Disconnect()
+		np.setConnected(false)
+	}
+}
+
+func (np *namedProducer) setConnected(connected bool) {
+	np.connected.Store(connected)
+
+	if connected {
+		np.disconnectedAt.Store(0)
+		return
+	}
+
+	np.disconnectedAt.CompareAndSwap(0, time.Now().UnixNano())
+}
+
+func (np *namedProducer) logReceived(msg sputnik.Msg, stop chan struct{}) {
+	// For disconnected state - save in the spool or forward to writer:
+	if !np.connected.Load() {
+		np.saveLog(msg)
+		return
+	}
+
+	mlog := np.mlogs[np.partition(msg)]
+
+	select {
+	case <-stop:
+		np.saveLog(msg)
+	case mlog <- msg:
+	}
+	return
+}
+
+// Returns index of the worker for the message
+func (np *namedProducer) partition(msg sputnik.Msg) int {
+	if len(np.mlogs) == 1 {
+		return 0
+	}
+
+	var key string
+
+	switch np.conf.PARTITION_KEY {
+	case PartitionByAppName:
+		key, _ = Part(msg, "app_name")
+		if len(key) == 0 {
+			key, _ = Part(msg, rfc3164OnlyKey)
+		}
+	case PartitionByTarget:
+		if targets, _ := Targets(msg); len(targets) > 0 {
+			key = targets[0]
+		}
+	default:
+		key, _ = Part(msg, "hostname")
+	}
+
+	return partitionOf(key, len(np.mlogs))
+}
+
+// Returns index of partition for the key
+func partitionOf(key string, partitions int) int {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+
+	return int(h.Sum32() % uint32(partitions))
+}
+
+func (np *namedProducer) work(mlog chan sputnik.Msg) {
+	defer np.workers.Done()
+
+	for {
+		select {
+		case logmsg := <-mlog:
+			np.processLog(logmsg)
+		case <-np.stop:
+			for {
+				select {
+				case logmsg := <-mlog:
+					np.processLog(logmsg)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (np *namedProducer) processLog(logmsg sputnik.Msg) {
+	// Keep order of the messages: spooled messages are produced first.
+	// The message is saved under the lock of the spool, so it cannot
+	// overtake messages of the same key saved by another worker
+	if spooled, err := np.spool.putIfNotEmpty(logmsg); spooled || (err != nil) {
+		if spooled {
+			np.count(outcomeSpooled, np.targetsOf(logmsg))
+			Put(logmsg)
+		} else {
+			np.sendToWriter(logmsg)
+		}
+		np.drainSpool()
+		return
+	}
+
+	if !np.breaker.allow() {
+		np.saveLog(logmsg)
+		return
+	}
+
+	targets := np.targetsOf(logmsg)
+
+	err := np.produce(logmsg)
+
+	if err == nil {
+		np.count(outcomeProduced, targets)
+		return
+	}
+
+	np.count(outcomeFailed, targets)
+
+	if IsRetryable(err) {
+		np.saveLog(logmsg)
+		return
+	}
+
+	np.sendToWriter(logmsg)
+	return
+}
+
+// Produces message according to retry policy and
+// updates state of the circuit breaker
+func (np *namedProducer) produce(logmsg sputnik.Msg) error {
+	started := time.Now()
+	defer func() {
+		mProduceDuration.observe(time.Since(started).Seconds(), np.label())
+	}()
+
+	err, cancelled := np.retry.run(func() error {
+		np.mpLock.RLock()
+		defer np.mpLock.RUnlock()
+		return np.mp.Produce(logmsg)
+	}, np.stop)
+
+	switch {
+	case err == nil:
+		np.breaker.success()
+	case cancelled || !IsRetryable(err):
+		np.breaker.release()
+	default:
+		np.breaker.failure()
+	}
+
+	return err
+}
+
+const (
+	spoolDrainInterval = time.Second
+	spoolDrainBatch    = 1000
+)
+
+// Produces spooled messages.
+// Number of messages is limited for fast return to processing of new messages
+func (np *namedProducer) drainSpool() {
+	if !np.drainLock.TryLock() {
+		return
+	}
+	defer np.drainLock.Unlock()
+
+	for i := 0; i < spoolDrainBatch; i++ {
+		if !np.connected.Load() {
+			return
+		}
+
+		if np.spool.len() == 0 {
+			return
+		}
+
+		if !np.breaker.allow() {
+			return
+		}
+
+		logmsg, ok := np.spool.peek()
+		if !ok {
+			np.breaker.release()
+			return
+		}
+
+		logmsg[producerKey] = np.name
+
+		targets := np.targetsOf(logmsg)
+
+		err := np.produce(logmsg)
+
+		if err == nil {
+			np.spool.commit()
+			np.count(outcomeProduced, targets)
+			continue
+		}
+
+		if IsRetryable(err) {
+			Put(logmsg)
+			return
+		}
+
+		np.spool.commit()
+		np.count(outcomeFailed, targets)
+		np.sendToWriter(logmsg)
+	}
+}
+
+// Saves message in the spool. If spool is not used or full - sends message to writer
+func (np *namedProducer) saveLog(logmsg sputnik.Msg) {
+	if np.spool != nil {
+		if err := np.spool.put(logmsg); err == nil {
+			np.count(outcomeSpooled, np.targetsOf(logmsg))
+			Put(logmsg)
+			return
+		}
+	}
+
+	np.sendToWriter(logmsg)
+}
+
+func (np *namedProducer) sendToWriter(logmsg sputnik.Msg) {
+	targets := np.targetsOf(logmsg)
+
+	if np.writer == nil {
+		np.count(outcomeDiscarded, targets)
+		Put(logmsg)
+		return
+	}
+
+	np.writer.Send(logmsg)
+	np.count(outcomeWriter, targets)
+}
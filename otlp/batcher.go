@@ -0,0 +1,176 @@
+package otlp
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/g41797/syslogsidecar"
+)
+
+// Buffers log records and exports them in batches: when the batch is full,
+// every flush interval and on close.
+// Records of failed export are returned to the buffer for retryable failure
+// and dropped for permanent one.
+type batcher struct {
+	lock     sync.Mutex
+	records  []*logRecord
+	inflight int
+	size     int
+	maxQueue int
+	lastErr  error
+	closed   bool
+
+	// One export at a time
+	exporting sync.Mutex
+	export    func([]*logRecord) error
+
+	interval time.Duration
+	kick     chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+func newBatcher(size int, maxQueue int, interval time.Duration, export func([]*logRecord) error) *batcher {
+	bt := new(batcher)
+	bt.size = size
+	bt.maxQueue = maxQueue
+	bt.interval = interval
+	bt.export = export
+	bt.kick = make(chan struct{}, 1)
+	bt.stop = make(chan struct{})
+	bt.done = make(chan struct{})
+
+	go bt.run()
+
+	return bt
+}
+
+// Adds record to the buffer.
+// Returns retryable error for full buffer (collector is not available)
+func (bt *batcher) add(rec *logRecord) error {
+	bt.lock.Lock()
+	defer bt.lock.Unlock()
+
+	if bt.closed {
+		return fmt.Errorf("OTLP producer is not connected")
+	}
+
+	if len(bt.records)+bt.inflight >= bt.maxQueue {
+		return fmt.Errorf("OTLP buffer is full, last export error: %v", bt.lastErr)
+	}
+
+	bt.records = append(bt.records, rec)
+
+	if len(bt.records) >= bt.size {
+		select {
+		case bt.kick <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+func (bt *batcher) run() {
+	defer close(bt.done)
+
+	ticker := time.NewTicker(bt.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-bt.stop:
+			return
+		case <-bt.kick:
+			bt.exportFull()
+		case <-ticker.C:
+			bt.flush()
+		}
+	}
+}
+
+// Exports full batches
+func (bt *batcher) exportFull() {
+	for {
+		bt.lock.Lock()
+		full := len(bt.records) >= bt.size
+		bt.lock.Unlock()
+
+		if !full {
+			return
+		}
+
+		if err := bt.exportNext(); err != nil {
+			return
+		}
+	}
+}
+
+// Exports all buffered records, returns the first error of the export
+func (bt *batcher) flush() error {
+	for {
+		bt.lock.Lock()
+		empty := len(bt.records) == 0
+		bt.lock.Unlock()
+
+		if empty {
+			return nil
+		}
+
+		if err := bt.exportNext(); err != nil {
+			return err
+		}
+	}
+}
+
+// Exports the oldest batch
+func (bt *batcher) exportNext() error {
+	bt.exporting.Lock()
+	defer bt.exporting.Unlock()
+
+	bt.lock.Lock()
+	n := len(bt.records)
+	if n > bt.size {
+		n = bt.size
+	}
+	batch := bt.records[:n:n]
+	bt.records = bt.records[n:]
+	bt.inflight = n
+	bt.lock.Unlock()
+
+	if n == 0 {
+		return nil
+	}
+
+	err := bt.export(batch)
+
+	bt.lock.Lock()
+	defer bt.lock.Unlock()
+
+	bt.inflight = 0
+	bt.lastErr = err
+
+	if syslogsidecar.IsRetryable(err) {
+		bt.records = append(batch, bt.records...)
+	}
+
+	return err
+}
+
+// Stops periodic export and exports buffered records
+func (bt *batcher) close() {
+	bt.lock.Lock()
+	closed := bt.closed
+	bt.closed = true
+	bt.lock.Unlock()
+
+	if closed {
+		return
+	}
+
+	close(bt.stop)
+	<-bt.done
+
+	bt.flush()
+}
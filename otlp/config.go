@@ -0,0 +1,106 @@
+package otlp
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// OTLP transports
+const (
+	ProtocolHTTPProtobuf = "http/protobuf"
+	ProtocolHTTPJSON     = "http/json"
+	ProtocolGRPC         = "grpc"
+)
+
+// Configuration of OTLP producer is stored in syslogproducer.json
+// (syslogproducer_<name>.json for named producer) together with
+// configuration of syslogsidecar producer
+type Configuration struct {
+	// "http/protobuf" (default), "http/json" or "grpc"
+	OTLP_PROTOCOL string
+
+	// URL of the collector, default:
+	//	"http://localhost:4318/v1/logs" - for HTTP
+	//	"http://localhost:4317"         - for gRPC, "https://" - gRPC over TLS
+	OTLP_ENDPOINT string
+
+	// Additional HTTP headers (gRPC metadata), e.g. for authentication
+	OTLP_HEADERS map[string]string
+
+	// Timeout of export in milliseconds (default 10000)
+	OTLP_TIMEOUT_MS int
+
+	// Max number of log records in one export (default 512)
+	OTLP_BATCH_SIZE int
+
+	// Buffered log records are exported at least every OTLP_FLUSH_INTERVAL_MS
+	// milliseconds (default 1000)
+	OTLP_FLUSH_INTERVAL_MS int
+
+	// Max number of buffered log records (default 2048).
+	// Produce returns retryable error for full buffer
+	OTLP_MAX_QUEUE_SIZE int
+
+	// Resource attributes added to every exported log record,
+	// e.g. "deployment.environment": "production"
+	OTLP_RESOURCE map[string]string
+}
+
+const (
+	defaultHTTPEndpoint = "http://localhost:4318/v1/logs"
+	defaultGRPCEndpoint = "http://localhost:4317"
+	defaultTimeout      = 10 * time.Second
+	defaultBatchSize    = 512
+	defaultInterval     = time.Second
+	defaultMaxQueue     = 2048
+)
+
+func (conf *Configuration) prepare() error {
+	switch conf.OTLP_PROTOCOL {
+	case "":
+		conf.OTLP_PROTOCOL = ProtocolHTTPProtobuf
+	case ProtocolHTTPProtobuf, ProtocolHTTPJSON, ProtocolGRPC:
+	default:
+		return fmt.Errorf("wrong OTLP protocol %s", conf.OTLP_PROTOCOL)
+	}
+
+	if len(conf.OTLP_ENDPOINT) == 0 {
+		conf.OTLP_ENDPOINT = defaultHTTPEndpoint
+		if conf.OTLP_PROTOCOL == ProtocolGRPC {
+			conf.OTLP_ENDPOINT = defaultGRPCEndpoint
+		}
+	}
+
+	if !strings.Contains(conf.OTLP_ENDPOINT, "://") {
+		conf.OTLP_ENDPOINT = "http://" + conf.OTLP_ENDPOINT
+	}
+
+	if conf.OTLP_BATCH_SIZE <= 0 {
+		conf.OTLP_BATCH_SIZE = defaultBatchSize
+	}
+
+	if conf.OTLP_MAX_QUEUE_SIZE <= 0 {
+		conf.OTLP_MAX_QUEUE_SIZE = defaultMaxQueue
+	}
+
+	if conf.OTLP_MAX_QUEUE_SIZE < conf.OTLP_BATCH_SIZE {
+		conf.OTLP_MAX_QUEUE_SIZE = conf.OTLP_BATCH_SIZE
+	}
+
+	return nil
+}
+
+func (conf *Configuration) timeout() time.Duration {
+	if conf.OTLP_TIMEOUT_MS <= 0 {
+		return defaultTimeout
+	}
+	return time.Duration(conf.OTLP_TIMEOUT_MS) * time.Millisecond
+}
+
+func (conf *Configuration) interval() time.Duration {
+	if conf.OTLP_FLUSH_INTERVAL_MS <= 0 {
+		return defaultInterval
+	}
+	return time.Duration(conf.OTLP_FLUSH_INTERVAL_MS) * time.Millisecond
+}
@@ -0,0 +1,202 @@
+package otlp
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/g41797/syslogsidecar"
+	"golang.org/x/net/http2"
+)
+
+// Path of Export method of gRPC LogsService
+const grpcExportPath = "/opentelemetry.proto.collector.logs.v1.LogsService/Export"
+
+// Sends export requests to the collector
+type exporter struct {
+	conf     Configuration
+	url      string
+	client   *http.Client
+	resource []keyValue
+}
+
+func newExporter(conf Configuration) *exporter {
+	ex := new(exporter)
+	ex.conf = conf
+	ex.url = conf.OTLP_ENDPOINT
+	ex.client = &http.Client{Timeout: conf.timeout()}
+
+	if conf.OTLP_PROTOCOL == ProtocolGRPC {
+		ex.url = strings.TrimSuffix(ex.url, "/") + grpcExportPath
+		ex.client.Transport = grpcTransport(strings.HasPrefix(ex.url, "http://"))
+	}
+
+	for _, key := range sortedKeys(conf.OTLP_RESOURCE) {
+		ex.resource = append(ex.resource, keyValue{key, stringValue(conf.OTLP_RESOURCE[key])})
+	}
+
+	return ex
+}
+
+// HTTP/2 transport for gRPC, for insecure connection - HTTP/2 without TLS (h2c)
+func grpcTransport(insecure bool) http.RoundTripper {
+	if !insecure {
+		return &http2.Transport{}
+	}
+
+	return &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, network, addr)
+		},
+	}
+}
+
+func (ex *exporter) close() {
+	ex.client.CloseIdleConnections()
+}
+
+// Exports the records. Errors of the export:
+//   - network errors and "throttling" responses (429, 502, 503, 504 or gRPC analogs) - retryable
+//   - other failures - permanent (see syslogsidecar.PermanentError)
+func (ex *exporter) export(records []*logRecord) error {
+	req := newExportRequest(records, ex.resource)
+
+	var (
+		body        []byte
+		contentType string
+		err         error
+	)
+
+	switch ex.conf.OTLP_PROTOCOL {
+	case ProtocolHTTPJSON:
+		contentType = "application/json"
+		if body, err = json.Marshal(req); err != nil {
+			return syslogsidecar.PermanentError(err)
+		}
+	case ProtocolGRPC:
+		contentType = "application/grpc"
+		body = grpcFrame(req.marshalProto())
+	default:
+		contentType = "application/x-protobuf"
+		body = req.marshalProto()
+	}
+
+	hreq, err := http.NewRequest(http.MethodPost, ex.url, bytes.NewReader(body))
+	if err != nil {
+		return syslogsidecar.PermanentError(err)
+	}
+
+	hreq.Header.Set("Content-Type", contentType)
+	if ex.conf.OTLP_PROTOCOL == ProtocolGRPC {
+		hreq.Header.Set("TE", "trailers")
+	}
+	for key, val := range ex.conf.OTLP_HEADERS {
+		hreq.Header.Set(key, val)
+	}
+
+	resp, err := ex.client.Do(hreq)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// Trailers are available after reading of the body
+	rbody, err := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	if err != nil {
+		return err
+	}
+
+	if ex.conf.OTLP_PROTOCOL == ProtocolGRPC {
+		return grpcStatus(resp)
+	}
+
+	return httpStatus(resp, rbody)
+}
+
+// Length-prefixed gRPC message without compression
+func grpcFrame(msg []byte) []byte {
+	frame := make([]byte, 5, 5+len(msg))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(msg)))
+	return append(frame, msg...)
+}
+
+func httpStatus(resp *http.Response, body []byte) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	err := fmt.Errorf("OTLP export failed: %s %s", resp.Status, bytes.TrimSpace(body))
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return err
+	}
+
+	return syslogsidecar.PermanentError(err)
+}
+
+// gRPC status codes for retry
+// https://opentelemetry.io/docs/specs/otlp/#failures
+var grpcRetryable = map[int]bool{
+	1:  true, // CANCELLED
+	4:  true, // DEADLINE_EXCEEDED
+	8:  true, // RESOURCE_EXHAUSTED
+	10: true, // ABORTED
+	11: true, // OUT_OF_RANGE
+	14: true, // UNAVAILABLE
+	15: true, // DATA_LOSS
+}
+
+func grpcStatus(resp *http.Response) error {
+	if resp.StatusCode != http.StatusOK {
+		return httpStatus(resp, nil)
+	}
+
+	// Trailers-only response contains status in headers
+	status := resp.Trailer.Get("grpc-status")
+	if len(status) == 0 {
+		status = resp.Header.Get("grpc-status")
+	}
+
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return fmt.Errorf("OTLP export failed: wrong grpc-status %q", status)
+	}
+
+	if code == 0 {
+		return nil
+	}
+
+	message := resp.Trailer.Get("grpc-message")
+	if len(message) == 0 {
+		message = resp.Header.Get("grpc-message")
+	}
+
+	err = fmt.Errorf("OTLP export failed: grpc-status %d %s", code, message)
+
+	if grpcRetryable[code] {
+		return err
+	}
+
+	return syslogsidecar.PermanentError(err)
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,332 @@
+package otlp
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// OTLP logs data model
+// https://github.com/open-telemetry/opentelemetry-proto/blob/main/opentelemetry/proto/logs/v1/logs.proto
+//
+
+type exportRequest struct {
+	ResourceLogs []*resourceLogs `json:"resourceLogs"`
+}
+
+type resourceLogs struct {
+	Resource  resource     `json:"resource"`
+	ScopeLogs []*scopeLogs `json:"scopeLogs"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes,omitempty"`
+}
+
+type scopeLogs struct {
+	Scope      scope        `json:"scope"`
+	LogRecords []*logRecord `json:"logRecords"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type logRecord struct {
+	TimeUnixNano         uint64     `json:"timeUnixNano,string,omitempty"`
+	ObservedTimeUnixNano uint64     `json:"observedTimeUnixNano,string"`
+	SeverityNumber       int        `json:"severityNumber,omitempty"`
+	SeverityText         string     `json:"severityText,omitempty"`
+	Body                 anyValue   `json:"body"`
+	Attributes           []keyValue `json:"attributes,omitempty"`
+
+	// Resource of the record, used for grouping of records
+	resource []keyValue
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+// String or int value
+type anyValue struct {
+	str   string
+	num   int64
+	isNum bool
+}
+
+func stringValue(str string) anyValue {
+	return anyValue{str: str}
+}
+
+func intValue(num int64) anyValue {
+	return anyValue{num: num, isNum: true}
+}
+
+// Int64 values are encoded as strings
+// https://opentelemetry.io/docs/specs/otlp/#json-protobuf-encoding
+func (av anyValue) MarshalJSON() ([]byte, error) {
+	if av.isNum {
+		return json.Marshal(map[string]string{"intValue": strconv.FormatInt(av.num, 10)})
+	}
+	return json.Marshal(map[string]string{"stringValue": av.str})
+}
+
+// Scope of exported records
+const scopeName = "github.com/g41797/syslogsidecar/otlp"
+
+// Mapping of syslog severity to OTLP SeverityNumber
+// https://opentelemetry.io/docs/specs/otel/logs/data-model-appendix/#appendix-b-severitynumber-example-mappings
+var severityNumbers = [...]int{
+	22, // emerg   - FATAL2
+	21, // alert   - FATAL
+	18, // crit    - ERROR2
+	17, // err     - ERROR
+	13, // warning - WARN
+	10, // notice  - INFO2
+	9,  // info    - INFO
+	5,  // debug   - DEBUG
+}
+
+var severityTexts = [...]string{"emerg", "alert", "crit", "err", "warning", "notice", "info", "debug"}
+
+// Builds log record from syslog parts of the message (see syslogsidecar.UnpackToMap):
+//   - hostname, app_name (tag for RFC3164), proc_id - resource attributes
+//   - severity - SeverityNumber and SeverityText
+//   - timestamp of the message - Timestamp, time of the export - ObservedTimestamp
+//   - message (content for RFC3164) - Body
+//   - facility, version, msg_id and params of structured data - attributes
+//   - parts added by processors - attributes with names of the parts
+//
+// Badly formatted message is exported as Body without severity
+func newLogRecord(parts map[string]string, observed time.Time) *logRecord {
+	rec := new(logRecord)
+	rec.ObservedTimeUnixNano = uint64(observed.UnixNano())
+
+	if data, exists := parts["data"]; exists {
+		rec.Body = stringValue(data)
+	} else {
+		rec.setRFCParts(parts)
+	}
+
+	for _, name := range extraParts(parts) {
+		rec.Attributes = appendString(rec.Attributes, name, parts[name])
+	}
+
+	return rec
+}
+
+// Converts timestamp in one of formats of syslogsidecar (RFC3339, Unix epoch ms or ns)
+// to nanoseconds since Unix epoch, 0 - unknown format
+func unixNano(timestamp string) uint64 {
+	if ts, err := time.Parse(time.RFC3339Nano, timestamp); err == nil {
+		return uint64(ts.UnixNano())
+	}
+
+	epoch, err := strconv.ParseUint(timestamp, 10, 64)
+	if err != nil {
+		return 0
+	}
+
+	// Milliseconds until year 2286
+	if len(timestamp) <= 13 {
+		return epoch * uint64(time.Millisecond)
+	}
+
+	return epoch
+}
+
+func (rec *logRecord) setRFCParts(parts map[string]string) {
+	rec.TimeUnixNano = unixNano(parts["timestamp"])
+
+	if sev, err := strconv.Atoi(parts["severity"]); err == nil && sev >= 0 && sev < len(severityNumbers) {
+		rec.SeverityNumber = severityNumbers[sev]
+		rec.SeverityText = severityTexts[sev]
+	}
+
+	rec.resource = appendString(rec.resource, "host.name", parts["hostname"])
+
+	if appName, exists := parts["app_name"]; exists {
+		rec.resource = appendString(rec.resource, "service.name", appName)
+		rec.Body = stringValue(parts["message"])
+	} else {
+		rec.resource = appendString(rec.resource, "service.name", parts["tag"])
+		rec.Body = stringValue(parts["content"])
+	}
+
+	if procID := parts["proc_id"]; len(procID) > 0 && procID != "-" {
+		if pid, err := strconv.ParseInt(procID, 10, 64); err == nil {
+			rec.resource = append(rec.resource, keyValue{"process.pid", intValue(pid)})
+		} else {
+			rec.Attributes = appendString(rec.Attributes, "syslog.proc_id", procID)
+		}
+	}
+
+	rec.Attributes = appendString(rec.Attributes, "syslog.format", parts["rfc"])
+	rec.Attributes = appendInt(rec.Attributes, "syslog.facility", parts["facility"])
+	rec.Attributes = appendInt(rec.Attributes, "syslog.version", parts["version"])
+
+	if msgID := parts["msg_id"]; msgID != "-" {
+		rec.Attributes = appendString(rec.Attributes, "syslog.msg_id", msgID)
+	}
+
+	for _, param := range structuredData(parts["structured_data"]) {
+		rec.Attributes = appendString(rec.Attributes, "syslog.sd."+param.Key, param.Value.str)
+	}
+}
+
+// Parts of syslog message and parts used by sidecar
+var knownParts = map[string]bool{
+	"rfc": true, "priority": true, "facility": true, "severity": true, "version": true,
+	"timestamp": true, "hostname": true, "app_name": true, "proc_id": true, "msg_id": true,
+	"structured_data": true, "message": true, "tag": true, "content": true, "data": true,
+	"targets": true,
+}
+
+// Returns sorted names of parts added by processors
+func extraParts(parts map[string]string) []string {
+	var names []string
+	for name := range parts {
+		if !knownParts[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func appendString(kvs []keyValue, key, val string) []keyValue {
+	if len(val) == 0 {
+		return kvs
+	}
+	return append(kvs, keyValue{key, stringValue(val)})
+}
+
+func appendInt(kvs []keyValue, key, val string) []keyValue {
+	num, err := strconv.ParseInt(val, 10, 64)
+	if err != nil {
+		return kvs
+	}
+	return append(kvs, keyValue{key, intValue(num)})
+}
+
+// Parses structured data of RFC5424 message, e.g.
+//
+//	[exampleSDID@32473 iut="3" eventSource="Application"][examplePriority@32473 class="high"]
+//
+// Returns params with keys "<SD-ID>.<PARAM-NAME>"
+func structuredData(sd string) []keyValue {
+	var params []keyValue
+
+	for len(sd) > 0 && sd[0] == '[' {
+		end := elementEnd(sd)
+		if end < 0 {
+			break
+		}
+
+		element := sd[1:end]
+		sd = sd[end+1:]
+
+		id, rest, _ := strings.Cut(element, " ")
+
+		for {
+			rest = strings.TrimLeft(rest, " ")
+
+			name, after, found := strings.Cut(rest, "=\"")
+			if !found {
+				break
+			}
+
+			val, tail := paramValue(after)
+			params = append(params, keyValue{id + "." + name, stringValue(val)})
+			rest = tail
+		}
+	}
+
+	sort.SliceStable(params, func(i, j int) bool { return params[i].Key < params[j].Key })
+
+	return params
+}
+
+// Returns index of ']' closing SD-ELEMENT, escaped '\]' within values is skipped
+func elementEnd(sd string) int {
+	inValue := false
+
+	for i := 1; i < len(sd); i++ {
+		switch sd[i] {
+		case '\\':
+			i++
+		case '"':
+			inValue = !inValue
+		case ']':
+			if !inValue {
+				return i
+			}
+		}
+	}
+
+	return -1
+}
+
+// Returns unescaped PARAM-VALUE and rest of SD-ELEMENT after closing '"'
+func paramValue(str string) (string, string) {
+	var sb strings.Builder
+
+	for i := 0; i < len(str); i++ {
+		switch str[i] {
+		case '\\':
+			if i+1 < len(str) {
+				i++
+				sb.WriteByte(str[i])
+			}
+		case '"':
+			return sb.String(), str[i+1:]
+		default:
+			sb.WriteByte(str[i])
+		}
+	}
+
+	return sb.String(), ""
+}
+
+// Groups records by resource
+func newExportRequest(records []*logRecord, extra []keyValue) *exportRequest {
+	req := new(exportRequest)
+	byResource := make(map[string]*scopeLogs)
+
+	for _, rec := range records {
+		key := resourceKey(rec.resource)
+
+		sl, exists := byResource[key]
+		if !exists {
+			sl = &scopeLogs{Scope: scope{Name: scopeName}}
+			byResource[key] = sl
+
+			attrs := append(append([]keyValue(nil), rec.resource...), extra...)
+			req.ResourceLogs = append(req.ResourceLogs, &resourceLogs{
+				Resource:  resource{Attributes: attrs},
+				ScopeLogs: []*scopeLogs{sl},
+			})
+		}
+
+		sl.LogRecords = append(sl.LogRecords, rec)
+	}
+
+	return req
+}
+
+func resourceKey(kvs []keyValue) string {
+	var sb strings.Builder
+	for _, kv := range kvs {
+		sb.WriteString(kv.Key)
+		sb.WriteByte(0)
+		sb.WriteString(kv.Value.str)
+		sb.WriteString(strconv.FormatInt(kv.Value.num, 10))
+		sb.WriteByte(0)
+	}
+	return sb.String()
+}
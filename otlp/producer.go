@@ -0,0 +1,124 @@
+package otlp
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/g41797/sputnik"
+	"github.com/g41797/sputnik/sidecar"
+	"github.com/g41797/syslogsidecar"
+)
+
+// Name of the configuration of OTLP producer
+const ConfigName = syslogsidecar.ProducerName
+
+// Returns producer exporting syslog messages to OpenTelemetry collector.
+// Usage:
+//
+//	syslogsidecar.RegisterMessageProducerFactory(otlp.NewProducer)
+//
+// or together with another producer:
+//
+//	syslogsidecar.RegisterNamedMessageProducerFactory("otlp", otlp.NewProducer)
+func NewProducer() sidecar.MessageProducer {
+	return new(producer)
+}
+
+type producer struct {
+	lock    sync.RWMutex
+	conf    Configuration
+	exp     *exporter
+	batches *batcher
+}
+
+func (prd *producer) Connect(cf sputnik.ConfFactory, _ sputnik.ServerConnection) error {
+	var conf Configuration
+
+	if err := cf(ConfigName, &conf); err != nil {
+		return err
+	}
+
+	if err := conf.prepare(); err != nil {
+		return err
+	}
+
+	exp := newExporter(conf)
+
+	prd.Disconnect()
+
+	prd.lock.Lock()
+	defer prd.lock.Unlock()
+
+	prd.conf = conf
+	prd.exp = exp
+	prd.batches = newBatcher(conf.OTLP_BATCH_SIZE, conf.OTLP_MAX_QUEUE_SIZE, conf.interval(), exp.export)
+
+	return nil
+}
+
+// Exports buffered log records and closes connections to the collector
+func (prd *producer) Disconnect() {
+	prd.lock.Lock()
+	exp, batches := prd.exp, prd.batches
+	prd.exp = nil
+	prd.batches = nil
+	prd.lock.Unlock()
+
+	if batches != nil {
+		batches.close()
+	}
+
+	if exp != nil {
+		exp.close()
+	}
+}
+
+// Buffers the message for export, message is returned to the pool
+// after successful buffering
+func (prd *producer) Produce(msg sputnik.Msg) error {
+	prd.lock.RLock()
+	batches := prd.batches
+	prd.lock.RUnlock()
+
+	if batches == nil {
+		return fmt.Errorf("OTLP producer is not connected")
+	}
+
+	parts, err := syslogsidecar.UnpackToMap(msg)
+	if err != nil {
+		return syslogsidecar.PermanentError(err)
+	}
+
+	if err = batches.add(newLogRecord(parts, time.Now())); err != nil {
+		return err
+	}
+
+	syslogsidecar.Put(msg)
+
+	return nil
+}
+
+// Returns connector for sidecar without message broker:
+// the collector is "connected" by the producer
+func NewConnector() sputnik.ServerConnector {
+	return new(connector)
+}
+
+type connector struct {
+	connected atomic.Bool
+}
+
+func (c *connector) Connect(cf sputnik.ConfFactory) (sputnik.ServerConnection, error) {
+	c.connected.Store(true)
+	return c, nil
+}
+
+func (c *connector) IsConnected() bool {
+	return c.connected.Load()
+}
+
+func (c *connector) Disconnect() {
+	c.connected.Store(false)
+}
@@ -0,0 +1,477 @@
+package otlp
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/g41797/sputnik"
+	"github.com/g41797/syslogsidecar"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func rfc5424Parts() map[string]string {
+	return map[string]string{
+		"rfc":             "RFC5424",
+		"priority":        "34",
+		"facility":        "4",
+		"severity":        "2",
+		"version":         "1",
+		"timestamp":       "2003-10-11T22:14:15Z",
+		"hostname":        "mymachine.example.com",
+		"app_name":        "su",
+		"proc_id":         "1234",
+		"msg_id":          "ID47",
+		"structured_data": `[exampleSDID@32473 iut="3" eventSource="App\"lication"][origin ip="192.0.2.1"]`,
+		"message":         "'su root' failed for lonvick on /dev/pts/8",
+	}
+}
+
+func newMsg(t *testing.T, parts map[string]string) sputnik.Msg {
+	msg := syslogsidecar.Get()
+	if err := syslogsidecar.Pack(msg, parts); err != nil {
+		t.Fatalf("Pack error %v", err)
+	}
+	return msg
+}
+
+func confFactory(conf Configuration) sputnik.ConfFactory {
+	return func(name string, result any) error {
+		*result.(*Configuration) = conf
+		return nil
+	}
+}
+
+func Test_LogRecord(t *testing.T) {
+	observed := time.Now()
+	rec := newLogRecord(rfc5424Parts(), observed)
+
+	if rec.SeverityNumber != 18 || rec.SeverityText != "crit" {
+		t.Errorf("wrong severity %d %s", rec.SeverityNumber, rec.SeverityText)
+	}
+
+	if rec.TimeUnixNano != uint64(time.Date(2003, 10, 11, 22, 14, 15, 0, time.UTC).UnixNano()) {
+		t.Errorf("wrong timestamp %d", rec.TimeUnixNano)
+	}
+
+	if rec.ObservedTimeUnixNano != uint64(observed.UnixNano()) {
+		t.Errorf("wrong observed timestamp %d", rec.ObservedTimeUnixNano)
+	}
+
+	for _, ts := range []string{"2003-10-11T22:14:15.003Z", "1065910455003", "1065910455003000000"} {
+		if unixNano(ts) != 1065910455003000000 {
+			t.Errorf("wrong conversion of timestamp %s: %d", ts, unixNano(ts))
+		}
+	}
+
+	if rec.Body.str != "'su root' failed for lonvick on /dev/pts/8" {
+		t.Errorf("wrong body %s", rec.Body.str)
+	}
+
+	expected := map[string]anyValue{
+		"host.name":    stringValue("mymachine.example.com"),
+		"service.name": stringValue("su"),
+		"process.pid":  intValue(1234),
+	}
+	checkAttributes(t, rec.resource, expected)
+
+	expected = map[string]anyValue{
+		"syslog.format":                           stringValue("RFC5424"),
+		"syslog.facility":                         intValue(4),
+		"syslog.version":                          intValue(1),
+		"syslog.msg_id":                           stringValue("ID47"),
+		"syslog.sd.exampleSDID@32473.iut":         stringValue("3"),
+		"syslog.sd.exampleSDID@32473.eventSource": stringValue(`App"lication`),
+		"syslog.sd.origin.ip":                     stringValue("192.0.2.1"),
+	}
+	checkAttributes(t, rec.Attributes, expected)
+
+	bad := newLogRecord(map[string]string{"data": "garbage"}, observed)
+	if bad.Body.str != "garbage" || bad.SeverityNumber != 0 || len(bad.resource) != 0 {
+		t.Errorf("wrong record of badly formatted message %+v", bad)
+	}
+}
+
+func checkAttributes(t *testing.T, kvs []keyValue, expected map[string]anyValue) {
+	if len(kvs) != len(expected) {
+		t.Errorf("expected %d attributes actual %d: %+v", len(expected), len(kvs), kvs)
+	}
+
+	for _, kv := range kvs {
+		if val, exists := expected[kv.Key]; !exists || val != kv.Value {
+			t.Errorf("wrong attribute %s %+v", kv.Key, kv.Value)
+		}
+	}
+}
+
+// Fake collector saves received requests
+type collector struct {
+	lock     sync.Mutex
+	requests [][]byte
+	ctypes   []string
+	paths    []string
+	status   int
+	grpcCode string
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	c.lock.Lock()
+	c.requests = append(c.requests, body)
+	c.ctypes = append(c.ctypes, r.Header.Get("Content-Type"))
+	c.paths = append(c.paths, r.URL.Path)
+	status, grpcCode := c.status, c.grpcCode
+	c.lock.Unlock()
+
+	if r.Header.Get("Content-Type") == "application/grpc" {
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "grpc-status")
+		w.WriteHeader(http.StatusOK)
+		w.Write(grpcFrame(nil))
+		w.Header().Set("grpc-status", grpcCode)
+		return
+	}
+
+	if status == 0 {
+		status = http.StatusOK
+	}
+	w.WriteHeader(status)
+}
+
+func (c *collector) received() [][]byte {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return append([][]byte(nil), c.requests...)
+}
+
+func produce(t *testing.T, conf Configuration, msgs int) error {
+	prd := NewProducer()
+
+	if err := prd.Connect(confFactory(conf), nil); err != nil {
+		t.Fatalf("Connect error %v", err)
+	}
+	defer prd.Disconnect()
+
+	for i := 0; i < msgs; i++ {
+		if err := prd.Produce(newMsg(t, rfc5424Parts())); err != nil {
+			return err
+		}
+	}
+
+	return prd.(*producer).batches.flush()
+}
+
+func Test_ExportHTTPJSON(t *testing.T) {
+	coll := new(collector)
+	srv := httptest.NewServer(coll)
+	defer srv.Close()
+
+	conf := Configuration{
+		OTLP_PROTOCOL: ProtocolHTTPJSON,
+		OTLP_ENDPOINT: srv.URL + "/v1/logs",
+		OTLP_RESOURCE: map[string]string{"deployment.environment": "test"},
+	}
+
+	if err := produce(t, conf, 1); err != nil {
+		t.Fatalf("Produce error %v", err)
+	}
+
+	if len(coll.received()) != 1 || coll.ctypes[0] != "application/json" || coll.paths[0] != "/v1/logs" {
+		t.Fatalf("wrong requests %v %v", coll.ctypes, coll.paths)
+	}
+
+	var req struct {
+		ResourceLogs []struct {
+			Resource struct {
+				Attributes []struct {
+					Key   string
+					Value map[string]string
+				}
+			}
+			ScopeLogs []struct {
+				LogRecords []struct {
+					TimeUnixNano         string
+					ObservedTimeUnixNano string
+					SeverityNumber       int
+					Body                 map[string]string
+				}
+			}
+		}
+	}
+
+	if err := json.Unmarshal(coll.received()[0], &req); err != nil {
+		t.Fatalf("Unmarshal error %v", err)
+	}
+
+	rl := req.ResourceLogs[0]
+
+	attrs := make(map[string]map[string]string)
+	for _, attr := range rl.Resource.Attributes {
+		attrs[attr.Key] = attr.Value
+	}
+
+	if attrs["host.name"]["stringValue"] != "mymachine.example.com" ||
+		attrs["process.pid"]["intValue"] != "1234" ||
+		attrs["deployment.environment"]["stringValue"] != "test" {
+		t.Errorf("wrong resource attributes %v", attrs)
+	}
+
+	rec := rl.ScopeLogs[0].LogRecords[0]
+
+	if rec.SeverityNumber != 18 || rec.TimeUnixNano != "1065910455000000000" ||
+		len(rec.ObservedTimeUnixNano) == 0 || rec.Body["stringValue"] != rfc5424Parts()["message"] {
+		t.Errorf("wrong log record %+v", rec)
+	}
+}
+
+func Test_ExportHTTPProtobuf(t *testing.T) {
+	coll := new(collector)
+	srv := httptest.NewServer(coll)
+	defer srv.Close()
+
+	conf := Configuration{OTLP_ENDPOINT: srv.URL + "/v1/logs"}
+
+	if err := produce(t, conf, 1); err != nil {
+		t.Fatalf("Produce error %v", err)
+	}
+
+	if len(coll.received()) != 1 || coll.ctypes[0] != "application/x-protobuf" {
+		t.Fatalf("wrong requests %v", coll.ctypes)
+	}
+
+	checkProtoRequest(t, coll.received()[0])
+}
+
+func Test_ExportGRPC(t *testing.T) {
+	coll := &collector{grpcCode: "0"}
+	srv := httptest.NewServer(h2c.NewHandler(coll, &http2.Server{}))
+	defer srv.Close()
+
+	conf := Configuration{OTLP_PROTOCOL: ProtocolGRPC, OTLP_ENDPOINT: srv.URL}
+
+	if err := produce(t, conf, 1); err != nil {
+		t.Fatalf("Produce error %v", err)
+	}
+
+	if len(coll.received()) != 1 || coll.paths[0] != grpcExportPath {
+		t.Fatalf("wrong requests %v", coll.paths)
+	}
+
+	frame := coll.received()[0]
+	if len(frame) < 5 || int(binary.BigEndian.Uint32(frame[1:5])) != len(frame)-5 {
+		t.Fatalf("wrong gRPC frame")
+	}
+
+	checkProtoRequest(t, frame[5:])
+
+	coll.grpcCode = "14"
+	if err := produce(t, conf, 1); err == nil || !syslogsidecar.IsRetryable(err) {
+		t.Errorf("UNAVAILABLE should be retryable: %v", err)
+	}
+
+	coll.grpcCode = "3"
+	if err := produce(t, conf, 1); err == nil || syslogsidecar.IsRetryable(err) {
+		t.Errorf("INVALID_ARGUMENT should be permanent: %v", err)
+	}
+}
+
+func Test_ExportFailures(t *testing.T) {
+	coll := &collector{status: http.StatusServiceUnavailable}
+	srv := httptest.NewServer(coll)
+	defer srv.Close()
+
+	conf := Configuration{OTLP_ENDPOINT: srv.URL + "/v1/logs"}
+
+	if err := produce(t, conf, 1); err == nil || !syslogsidecar.IsRetryable(err) {
+		t.Errorf("503 should be retryable: %v", err)
+	}
+
+	coll.status = http.StatusBadRequest
+	if err := produce(t, conf, 1); err == nil || syslogsidecar.IsRetryable(err) {
+		t.Errorf("400 should be permanent: %v", err)
+	}
+
+	srv.Close()
+	if err := produce(t, conf, 1); err == nil || !syslogsidecar.IsRetryable(err) {
+		t.Errorf("network error should be retryable: %v", err)
+	}
+}
+
+func Test_Batching(t *testing.T) {
+	coll := new(collector)
+	srv := httptest.NewServer(coll)
+	defer srv.Close()
+
+	conf := Configuration{OTLP_ENDPOINT: srv.URL + "/v1/logs", OTLP_BATCH_SIZE: 4, OTLP_FLUSH_INTERVAL_MS: 60000}
+
+	prd := NewProducer()
+	if err := prd.Connect(confFactory(conf), nil); err != nil {
+		t.Fatalf("Connect error %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		if err := prd.Produce(newMsg(t, rfc5424Parts())); err != nil {
+			t.Fatalf("Produce error %v", err)
+		}
+	}
+
+	// Full batches are exported without waiting for the interval
+	waitRequests(t, coll, 2)
+
+	// The rest - on Disconnect
+	prd.Disconnect()
+
+	if requests := len(coll.received()); requests != 3 {
+		t.Errorf("expected 3 requests for 10 messages actual %d", requests)
+	}
+
+	// Flush interval
+	conf.OTLP_FLUSH_INTERVAL_MS = 50
+	if err := prd.Connect(confFactory(conf), nil); err != nil {
+		t.Fatalf("Connect error %v", err)
+	}
+	defer prd.Disconnect()
+
+	if err := prd.Produce(newMsg(t, rfc5424Parts())); err != nil {
+		t.Fatalf("Produce error %v", err)
+	}
+
+	waitRequests(t, coll, 4)
+}
+
+// Records of failed export stay in the buffer, for full buffer Produce fails
+func Test_BatchingBackpressure(t *testing.T) {
+	coll := &collector{status: http.StatusServiceUnavailable}
+	srv := httptest.NewServer(coll)
+	defer srv.Close()
+
+	conf := Configuration{OTLP_ENDPOINT: srv.URL + "/v1/logs", OTLP_BATCH_SIZE: 2, OTLP_MAX_QUEUE_SIZE: 2, OTLP_FLUSH_INTERVAL_MS: 60000}
+
+	prd := NewProducer()
+	if err := prd.Connect(confFactory(conf), nil); err != nil {
+		t.Fatalf("Connect error %v", err)
+	}
+	defer prd.Disconnect()
+
+	for i := 0; i < 2; i++ {
+		if err := prd.Produce(newMsg(t, rfc5424Parts())); err != nil {
+			t.Fatalf("Produce error %v", err)
+		}
+	}
+
+	msg := newMsg(t, rfc5424Parts())
+	if err := prd.Produce(msg); err == nil || !syslogsidecar.IsRetryable(err) {
+		t.Errorf("full buffer should be retryable error: %v", err)
+	}
+
+	coll.lock.Lock()
+	coll.status = http.StatusOK
+	coll.lock.Unlock()
+
+	if err := prd.(*producer).batches.flush(); err != nil {
+		t.Fatalf("flush error %v", err)
+	}
+
+	if err := prd.Produce(msg); err != nil {
+		t.Errorf("Produce after export error %v", err)
+	}
+}
+
+func waitRequests(t *testing.T, coll *collector, requests int) {
+	for start := time.Now(); len(coll.received()) < requests; time.Sleep(10 * time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatalf("expected %d requests actual %d", requests, len(coll.received()))
+		}
+	}
+}
+
+// Minimal protobuf decoder for checks of encoded request
+type protoField struct {
+	num    int
+	varint uint64
+	bytes  []byte
+}
+
+func decodeProto(t *testing.T, b []byte) []protoField {
+	var fields []protoField
+
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			t.Fatalf("wrong protobuf key")
+		}
+		b = b[n:]
+
+		field := protoField{num: int(key >> 3)}
+
+		switch key & 7 {
+		case wireVarint:
+			field.varint, n = binary.Uvarint(b)
+			b = b[n:]
+		case wireFixed64:
+			field.varint = binary.LittleEndian.Uint64(b)
+			b = b[8:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			field.bytes = b[n : n+int(size)]
+			b = b[n+int(size):]
+		default:
+			t.Fatalf("unexpected wire type %d", key&7)
+		}
+
+		fields = append(fields, field)
+	}
+
+	return fields
+}
+
+func protoChild(t *testing.T, b []byte, num int) []byte {
+	for _, field := range decodeProto(t, b) {
+		if field.num == num {
+			return field.bytes
+		}
+	}
+	t.Fatalf("field %d not found", num)
+	return nil
+}
+
+func checkProtoRequest(t *testing.T, req []byte) {
+	rl := protoChild(t, req, 1)
+	sl := protoChild(t, rl, 2)
+
+	if scopeName != string(protoChild(t, protoChild(t, sl, 1), 1)) {
+		t.Errorf("wrong scope")
+	}
+
+	rec := protoChild(t, sl, 2)
+
+	var severity, timestamp uint64
+	for _, field := range decodeProto(t, rec) {
+		switch field.num {
+		case 1:
+			timestamp = field.varint
+		case 2:
+			severity = field.varint
+		}
+	}
+
+	if severity != 18 || timestamp != 1065910455000000000 {
+		t.Errorf("wrong severity %d or timestamp %d", severity, timestamp)
+	}
+
+	if body := string(protoChild(t, protoChild(t, rec, 5), 1)); body != rfc5424Parts()["message"] {
+		t.Errorf("wrong body %s", body)
+	}
+
+	attr := protoChild(t, protoChild(t, rl, 1), 1)
+	if key := string(protoChild(t, attr, 1)); key != "host.name" {
+		t.Errorf("wrong first resource attribute %s", key)
+	}
+}
@@ -0,0 +1,133 @@
+package otlp
+
+import (
+	"encoding/binary"
+)
+
+//
+// Protobuf encoding of OTLP export request
+// https://protobuf.dev/programming-guides/encoding/
+//
+
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+type protoBuf struct {
+	b []byte
+}
+
+func (pb *protoBuf) varint(v uint64) {
+	pb.b = binary.AppendUvarint(pb.b, v)
+}
+
+func (pb *protoBuf) tag(field int, wire int) {
+	pb.varint(uint64(field)<<3 | uint64(wire))
+}
+
+func (pb *protoBuf) varintField(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	pb.tag(field, wireVarint)
+	pb.varint(v)
+}
+
+func (pb *protoBuf) fixed64Field(field int, v uint64) {
+	if v == 0 {
+		return
+	}
+	pb.tag(field, wireFixed64)
+	pb.b = binary.LittleEndian.AppendUint64(pb.b, v)
+}
+
+func (pb *protoBuf) stringField(field int, s string) {
+	if len(s) == 0 {
+		return
+	}
+	pb.tag(field, wireBytes)
+	pb.varint(uint64(len(s)))
+	pb.b = append(pb.b, s...)
+}
+
+// Encodes embedded message
+func (pb *protoBuf) messageField(field int, encode func(*protoBuf)) {
+	var embedded protoBuf
+	encode(&embedded)
+
+	pb.tag(field, wireBytes)
+	pb.varint(uint64(len(embedded.b)))
+	pb.b = append(pb.b, embedded.b...)
+}
+
+// ExportLogsServiceRequest
+func (req *exportRequest) marshalProto() []byte {
+	var pb protoBuf
+
+	for _, rl := range req.ResourceLogs {
+		pb.messageField(1, rl.encode)
+	}
+
+	return pb.b
+}
+
+// ResourceLogs
+func (rl *resourceLogs) encode(pb *protoBuf) {
+	pb.messageField(1, rl.Resource.encode)
+
+	for _, sl := range rl.ScopeLogs {
+		pb.messageField(2, sl.encode)
+	}
+}
+
+// Resource
+func (r *resource) encode(pb *protoBuf) {
+	encodeAttributes(pb, 1, r.Attributes)
+}
+
+// ScopeLogs
+func (sl *scopeLogs) encode(pb *protoBuf) {
+	pb.messageField(1, func(scpb *protoBuf) {
+		scpb.stringField(1, sl.Scope.Name)
+	})
+
+	for _, rec := range sl.LogRecords {
+		pb.messageField(2, rec.encode)
+	}
+}
+
+// LogRecord
+func (rec *logRecord) encode(pb *protoBuf) {
+	pb.fixed64Field(1, rec.TimeUnixNano)
+	pb.varintField(2, uint64(rec.SeverityNumber))
+	pb.stringField(3, rec.SeverityText)
+	pb.messageField(5, rec.Body.encode)
+	encodeAttributes(pb, 6, rec.Attributes)
+	pb.fixed64Field(11, rec.ObservedTimeUnixNano)
+}
+
+func encodeAttributes(pb *protoBuf, field int, kvs []keyValue) {
+	for _, kv := range kvs {
+		kv := kv
+		pb.messageField(field, func(kvpb *protoBuf) {
+			kvpb.stringField(1, kv.Key)
+			kvpb.messageField(2, kv.Value.encode)
+		})
+	}
+}
+
+// AnyValue
+func (av *anyValue) encode(pb *protoBuf) {
+	if av.isNum {
+		pb.tag(3, wireVarint)
+		pb.varint(uint64(av.num))
+		return
+	}
+
+	// Empty string is encoded explicitly - oneof field
+	pb.tag(1, wireBytes)
+	pb.varint(uint64(len(av.str)))
+	pb.b = append(pb.b, av.str...)
+}
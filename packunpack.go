@@ -1,7 +1,10 @@
 package syslogsidecar
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"sort"
 
 	"github.com/g41797/sputnik"
 )
@@ -33,7 +36,38 @@ func Unpack(msg sputnik.Msg, f func(partname string, val string) error) error {
 		return fmt.Errorf("wrong msg")
 	}
 
-	return syslogmsgparts.Unpack(f)
+	if err := syslogmsgparts.Unpack(f); err != nil {
+		return err
+	}
+
+	extras, _ := msg[extraparts].(map[string]string)
+
+	for _, name := range sortedKeys(extras) {
+		if err := f(name, extras[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+var errPartFound = errors.New("part found")
+
+// Returns value of the part of syslog message stored within msg
+func Part(msg sputnik.Msg, partname string) (string, bool) {
+	var value string
+	var found bool
+
+	Unpack(msg, func(name string, val string) error {
+		if name != partname {
+			return nil
+		}
+		value = val
+		found = true
+		return errPartFound
+	})
+
+	return value, found
 }
 
 func Pack(msg sputnik.Msg, parts map[string]string) error {
@@ -53,24 +87,145 @@ func Pack(msg sputnik.Msg, parts map[string]string) error {
 		msg[syslogmessage] = syslogmsgparts
 	}
 
-	var partsDescr []partType
-
-	switch count {
-	case badMessageParts:
-		partsDescr = formerMessage[:]
-	case rfc5424Parts:
-		partsDescr = rfc5424parts[:]
-	case rfc3164Parts:
-		partsDescr = rfc3164parts[:]
-	default:
+	partsDescr := descriptorOf(parts)
+	if partsDescr == nil {
 		return fmt.Errorf("wrong parts")
 	}
 
-	return pack(msg, parts, syslogmsgparts, partsDescr)
+	if err := pack(msg, parts, syslogmsgparts, partsDescr); err != nil {
+		return err
+	}
+
+	setExtraParts(msg, parts, partsDescr)
+
+	return nil
+}
+
+// Returns description of syslog parts according to rfc part
+func descriptorOf(parts map[string]string) []partType {
+	switch parts[rfcFormatKey] {
+	case rfc5424:
+		return rfc5424parts[:]
+	case rfc3164:
+		return rfc3164parts[:]
+	}
+
+	if _, exists := parts[Formermessage]; exists {
+		return formerMessage[:]
+	}
+
+	return nil
+}
+
+// Name of the message key with parts added by processors
+const extraparts = "extraparts"
+
+// Saves parts missing in description as extra parts of the message
+func setExtraParts(msg sputnik.Msg, parts map[string]string, expected []partType) {
+	delete(msg, extraparts)
+
+	if len(parts) == len(expected) {
+		return
+	}
+
+	extras := make(map[string]string)
+
+	for name, val := range parts {
+		extras[name] = val
+	}
+
+	for _, part := range expected {
+		delete(extras, part.name)
+	}
+
+	if len(extras) > 0 {
+		msg[extraparts] = extras
+	}
+}
+
+// Sets value of the part of syslog message stored within msg.
+// Part which does not exist in RFC format of the message
+// is added to the message as "extra" part, e.g. parsed
+// field of the message or name of the listener.
+// Extra parts are unpacked after RFC parts in order of names
+func SetPart(msg sputnik.Msg, partname string, value string) error {
+	if partname == rfcFormatKey {
+		return fmt.Errorf("%s cannot be changed", partname)
+	}
+
+	parts, err := UnpackToMap(msg)
+	if err != nil {
+		return err
+	}
+
+	parts[partname] = value
+
+	return Pack(msg, parts)
+}
+
+// Removes extra part of the message. RFC parts cannot be removed
+func DeletePart(msg sputnik.Msg, partname string) {
+	extras, _ := msg[extraparts].(map[string]string)
+	delete(extras, partname)
+}
+
+// Name of the part with targets set by processor
+const targetsPart = "targets"
+
+// Replaces targets of the message defined by syslogconf.json, e.g. for rerouting
+// of the message by processor. Targets are saved in the extra part "targets"
+// as JSON array. nil - removes replacement
+func SetTargets(msg sputnik.Msg, targets []string) error {
+	if targets == nil {
+		DeletePart(msg, targetsPart)
+		return nil
+	}
+
+	value, err := json.Marshal(targets)
+	if err != nil {
+		return err
+	}
+
+	return SetPart(msg, targetsPart, string(value))
+}
+
+// Returns targets set by SetTargets
+func replacedTargets(msg sputnik.Msg) ([]string, bool) {
+	extras, _ := msg[extraparts].(map[string]string)
+
+	value, exists := extras[targetsPart]
+	if !exists {
+		return nil, false
+	}
+
+	var targets []string
+
+	if err := json.Unmarshal([]byte(value), &targets); err != nil {
+		return nil, false
+	}
+
+	return targets, true
+}
+
+// Returns sorted keys of the map
+func sortedKeys[V any](m map[string]V) []string {
+	if len(m) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
 }
 
 func pack(msg sputnik.Msg, parts map[string]string, syslogmsgparts *syslogmsgparts, expected []partType) error {
 
+	syslogmsgparts.set(128)
+
 	count := len(expected)
 	syslogmsgparts.setRuneAt(0, rune(count))
 	syslogmsgparts.skip(count + 1)
@@ -26,6 +26,12 @@ func (p *parts) set(initialCapacity int) {
 	p.rewind()
 }
 
+// Copies content of another instance
+func (p *parts) copyFrom(src *parts) {
+	p.data = append(p.data[:0], src.data...)
+	p.position = src.position
+}
+
 // Appends a text to the parts instance
 func (p *parts) appendText(text string) int {
 	if len(text) == 0 {
@@ -44,7 +50,7 @@ func (p *parts) appendText(text string) int {
 // Appends a single character to the parts instance
 func (p *parts) appendRune(char rune) int {
 	newLen := p.position + 1
-	if newLen >= cap(p.data) {
+	if newLen >= len(p.data) {
 		p.grow(newLen)
 	}
 	p.data[p.position] = char
@@ -72,7 +78,7 @@ func (p *parts) skip(forward int) error {
 
 	newPos := p.position + forward
 
-	if newPos >= len(p.data) {
+	if newPos > len(p.data) {
 		return fmt.Errorf("cannot skip after end")
 	}
 
@@ -107,7 +113,7 @@ func (p *parts) setRuneAt(index int, val rune) error {
 
 func (p *parts) resize(text string) {
 	newLen := p.position + len(text)
-	if newLen > cap(p.data) {
+	if newLen > len(p.data) {
 		p.grow(newLen)
 	}
 }
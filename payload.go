@@ -0,0 +1,85 @@
+package syslogsidecar
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Outcomes of parsing of payloads
+const (
+	parseParsed = "parsed"
+	parseFailed = "failed"
+)
+
+// Returns text of the message (see messagePartOf) with removed leading spaces
+func payloadOf(parts map[string]string) string {
+	return strings.TrimLeft(parts[messagePartOf(parts)], " \t")
+}
+
+// Headers of non-parsed syslog messages: RFC5424, RFC3164 with and without tag
+var syslogHeaders = []*regexp.Regexp{
+	regexp.MustCompile(`^<\d{1,3}>\d{1,2} \S+ \S+ \S+ \S+ \S+ (?:-|(?:\[[^\]]*\])+) `),
+	regexp.MustCompile(`^<\d{1,3}>[A-Za-z]{3} [ \d]\d \d{2}:\d{2}:\d{2} \S+ `),
+	regexp.MustCompile(`^<\d{1,3}>[A-Za-z]{3} [ \d]\d \d{2}:\d{2}:\d{2} \S+ \S+: `),
+}
+
+// Returns payload which starts from the marker, e.g. "CEF:".
+// Marker should be at the beginning of the payload or, for non-parsed
+// syslog message, right after its header.
+// For RFC3164 message marker without ':' may be parsed as tag
+// and the rest of the payload as content
+func markedPayload(parts map[string]string, marker string) (string, bool) {
+	payload := payloadOf(parts)
+
+	if parts[rfcFormatKey] == rfc3164 && parts[rfc3164OnlyKey]+":" == marker {
+		return marker + payload, true
+	}
+
+	if strings.HasPrefix(payload, marker) {
+		return payload, true
+	}
+
+	if messagePartOf(parts) != Formermessage {
+		return "", false
+	}
+
+	for _, header := range syslogHeaders {
+		if loc := header.FindStringIndex(payload); loc != nil && strings.HasPrefix(payload[loc[1]:], marker) {
+			return payload[loc[1]:], true
+		}
+	}
+
+	return "", false
+}
+
+// Replaces backslash escapes: \n, \r, \t and \<char> -> <char>
+func unescapeBackslash(text string) string {
+	if !strings.Contains(text, `\`) {
+		return text
+	}
+
+	var sb strings.Builder
+
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		if c != '\\' || i == len(text)-1 {
+			sb.WriteByte(c)
+			continue
+		}
+
+		i++
+
+		switch text[i] {
+		case 'n':
+			sb.WriteByte('\n')
+		case 'r':
+			sb.WriteByte('\r')
+		case 't':
+			sb.WriteByte('\t')
+		default:
+			sb.WriteByte(text[i])
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,193 @@
+package syslogsidecar
+
+import (
+	"sync"
+	"time"
+
+	"github.com/g41797/sputnik"
+)
+
+// Chain of processors between receiver and producer
+type pipeline struct {
+	processors []Processor
+	send       func(msg sputnik.Msg)
+
+	// Message channel per worker,
+	// without workers processing runs in the goroutine of the caller
+	mlogs   []chan sputnik.Msg
+	workers sync.WaitGroup
+
+	// Periodic flush of processors implementing Flusher
+	flushers map[int]Flusher
+	quit     chan struct{}
+	flushing sync.WaitGroup
+
+	// TIMESTAMP_FORMAT and TIMESTAMP_UTC of the receiver
+	tsFormat string
+	tsUTC    bool
+}
+
+// Processor creating own messages (e.g. notices) formats their timestamps
+// like timestamps of received messages
+type timestampSetter interface {
+	setTimestampFormat(form string, utc bool)
+}
+
+// Interval between calls of Flush
+const flushInterval = time.Second
+
+func newPipeline(send func(msg sputnik.Msg)) *pipeline {
+	pl := new(pipeline)
+	pl.send = send
+	return pl
+}
+
+// Creates and initiates processors
+func (pl *pipeline) init(names []string, cf sputnik.ConfFactory, workers int) error {
+	for _, name := range names {
+		prc, err := newProcessor(name)
+		if err != nil {
+			return err
+		}
+
+		if err = prc.Init(cf); err != nil {
+			return err
+		}
+
+		if setter, ok := prc.(timestampSetter); ok {
+			setter.setTimestampFormat(pl.tsFormat, pl.tsUTC)
+		}
+
+		if flusher, ok := prc.(Flusher); ok {
+			if pl.flushers == nil {
+				pl.flushers = make(map[int]Flusher)
+			}
+			pl.flushers[len(pl.processors)] = flusher
+		}
+
+		pl.processors = append(pl.processors, prc)
+	}
+
+	if len(pl.processors) == 0 {
+		return nil
+	}
+
+	pl.mlogs = make([]chan sputnik.Msg, workers)
+	for i := range pl.mlogs {
+		pl.mlogs[i] = make(chan sputnik.Msg, 1)
+	}
+
+	return nil
+}
+
+func (pl *pipeline) start() {
+	for _, mlog := range pl.mlogs {
+		pl.workers.Add(1)
+		go pl.work(mlog)
+	}
+
+	if len(pl.flushers) > 0 {
+		pl.quit = make(chan struct{})
+		pl.flushing.Add(1)
+		go pl.flushPeriodically()
+	}
+}
+
+// Waits processing of already pushed messages
+func (pl *pipeline) stop() {
+	for _, mlog := range pl.mlogs {
+		close(mlog)
+	}
+
+	pl.workers.Wait()
+
+	pl.mlogs = nil
+
+	if pl.quit == nil {
+		return
+	}
+
+	close(pl.quit)
+	pl.flushing.Wait()
+	pl.quit = nil
+
+	pl.flush(true)
+}
+
+// Processes the message by processors and sends results.
+// Messages with the same hostname are processed by the same worker
+func (pl *pipeline) push(msg sputnik.Msg) {
+	switch len(pl.mlogs) {
+	case 0:
+		pl.process(msg)
+	case 1:
+		pl.mlogs[0] <- msg
+	default:
+		hostname, _ := Part(msg, "hostname")
+		pl.mlogs[partitionOf(hostname, len(pl.mlogs))] <- msg
+	}
+}
+
+func (pl *pipeline) work(mlog chan sputnik.Msg) {
+	defer pl.workers.Done()
+
+	for msg := range mlog {
+		pl.process(msg)
+	}
+}
+
+func (pl *pipeline) process(msg sputnik.Msg) {
+	pl.processFrom(0, []sputnik.Msg{msg})
+}
+
+// Processes messages by processors starting from processor with index first
+func (pl *pipeline) processFrom(first int, msgs []sputnik.Msg) {
+	for _, prc := range pl.processors[first:] {
+		var next []sputnik.Msg
+
+		for _, m := range msgs {
+			next = append(next, prc.Process(m)...)
+		}
+
+		if len(next) == 0 {
+			return
+		}
+
+		msgs = next
+	}
+
+	for _, m := range msgs {
+		pl.send(m)
+	}
+}
+
+func (pl *pipeline) flushPeriodically() {
+	defer pl.flushing.Done()
+
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-pl.quit:
+			return
+		case <-ticker.C:
+			pl.flush(false)
+		}
+	}
+}
+
+// Flushes processors in order of processing,
+// flushed messages are processed by the next processors
+func (pl *pipeline) flush(final bool) {
+	for i := range pl.processors {
+		flusher, ok := pl.flushers[i]
+		if !ok {
+			continue
+		}
+
+		if msgs := flusher.Flush(final); len(msgs) > 0 {
+			pl.processFrom(i+1, msgs)
+		}
+	}
+}
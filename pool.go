@@ -11,9 +11,42 @@ func Get() sputnik.Msg {
 }
 
 func Put(msg sputnik.Msg) {
+	for key := range msg {
+		if key != syslogmessage {
+			delete(msg, key)
+		}
+	}
 	mPool.Put(msg)
 }
 
+// Returns copy of the message, the copy should be returned to the pool by Put
+func Clone(msg sputnik.Msg) sputnik.Msg {
+	result := Get()
+
+	for key, val := range msg {
+		if key != syslogmessage {
+			result[key] = val
+		}
+	}
+
+	if extras, exists := msg[extraparts].(map[string]string); exists {
+		copied := make(map[string]string, len(extras))
+		for name, val := range extras {
+			copied[name] = val
+		}
+		result[extraparts] = copied
+	}
+
+	src, ok := msg[syslogmessage].(*syslogmsgparts)
+	if !ok {
+		return result
+	}
+
+	result[syslogmessage].(*syslogmsgparts).copyFrom(&src.parts)
+
+	return result
+}
+
 var mPool = sync.Pool{New: newMessage}
 
 const syslogmessage = "syslogmessage"
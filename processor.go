@@ -0,0 +1,77 @@
+package syslogsidecar
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+
+	"github.com/g41797/sputnik"
+)
+
+// Processor inspects and changes messages between receiver and producer.
+// Use Part, SetPart, DeletePart, Clone and SetTargets for access to the message.
+type Processor interface {
+	// Called once before processing of the messages.
+	// Configuration of the processor is read using cf,
+	// e.g. cf("redaction", &conf) for redaction.json
+	Init(cf sputnik.ConfFactory) error
+
+	// Returns messages for the next processor (producer for the last one):
+	//	- nil or empty - the message was dropped
+	//	- the same message, possibly changed
+	//	- several messages, e.g. the message and its clone with another targets
+	//
+	// Message which was not returned is owned by the processor:
+	// it should be returned to the pool (see Put) or kept for sending later.
+	// For PROCESSOR_WORKERS > 1 Process is called concurrently
+	Process(msg sputnik.Msg) []sputnik.Msg
+}
+
+// Optional interface of the processor which keeps messages for sending later,
+// e.g. summaries of suppressed duplicates
+type Flusher interface {
+	// Called periodically (every second) and once more (final == true)
+	// after processing of the last message.
+	// Returned messages are processed by the next processors.
+	// Flush is called concurrently with Process
+	Flush(final bool) []sputnik.Msg
+}
+
+// Registers factory of the processor.
+// Processors listed in PROCESSORS of syslogreceiver.json
+// process messages in order of the list
+func RegisterProcessorFactory(name string, fact func() Processor) {
+	if fact == nil {
+		delete(prcfs, name)
+		return
+	}
+
+	prcfs[name] = fact
+}
+
+var prcfs = make(map[string]func() Processor)
+
+func newProcessor(name string) (Processor, error) {
+	fact, exists := prcfs[name]
+	if !exists {
+		return nil, fmt.Errorf("processor %s is not registered", name)
+	}
+
+	prc := fact()
+	if prc == nil {
+		return nil, fmt.Errorf("factory of processor %s returned nil", name)
+	}
+
+	return prc, nil
+}
+
+// Reads optional configuration of the processor, absent file is not error
+func readProcessorConfiguration(cf sputnik.ConfFactory, name string, conf any) error {
+	err := cf(name, conf)
+
+	if (err == nil) || errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+
+	return err
+}
@@ -0,0 +1,201 @@
+package syslogsidecar
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/g41797/sputnik"
+)
+
+func Test_ExtraParts(t *testing.T) {
+	in := makeRFC5424Msg()
+	in["listener"] = "udp/127.0.0.1:5141"
+
+	msg := Get()
+	defer Put(msg)
+
+	if err := Pack(msg, in); err != nil {
+		t.Fatalf("Pack error %v", err)
+	}
+
+	out, err := UnpackToMap(msg)
+	if err != nil {
+		t.Fatalf("Unpack error %v", err)
+	}
+
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("Expected %v Actual %v", in, out)
+	}
+
+	if err = SetPart(msg, "message", "changed"); err != nil {
+		t.Fatalf("SetPart error %v", err)
+	}
+
+	if err = SetPart(msg, "user", "root"); err != nil {
+		t.Fatalf("SetPart error %v", err)
+	}
+
+	if err = SetPart(msg, rfcFormatKey, rfc3164); err == nil {
+		t.Errorf("rfc part should not be changed")
+	}
+
+	cpy := Clone(msg)
+	defer Put(cpy)
+
+	DeletePart(msg, "user")
+
+	checkPart(t, msg, "message", "changed", true)
+	checkPart(t, msg, "listener", "udp/127.0.0.1:5141", true)
+	checkPart(t, msg, "user", "", false)
+	checkPart(t, cpy, "user", "root", true)
+
+	if err = SetTargets(msg, []string{"nats:critical", "archive"}); err != nil {
+		t.Fatalf("SetTargets error %v", err)
+	}
+
+	targets, err := Targets(msg)
+	if err != nil || !reflect.DeepEqual(targets, []string{"nats:critical", "archive"}) {
+		t.Errorf("wrong replaced targets %v %v", targets, err)
+	}
+}
+
+func checkPart(t *testing.T, msg sputnik.Msg, name, expected string, exists bool) {
+	val, found := Part(msg, name)
+	if found != exists || val != expected {
+		t.Errorf("part %s: expected %q (%v) actual %q (%v)", name, expected, exists, val, found)
+	}
+}
+
+// Drops messages with severity above 3
+type dropProcessor struct{}
+
+func (dp *dropProcessor) Init(cf sputnik.ConfFactory) error {
+	return nil
+}
+
+func (dp *dropProcessor) Process(msg sputnik.Msg) []sputnik.Msg {
+	sev, _ := Part(msg, severityKey)
+	if sevval, _ := strconv.Atoi(sev); sevval > 3 {
+		Put(msg)
+		return nil
+	}
+	return []sputnik.Msg{msg}
+}
+
+// Sends copy of every message to "archive"
+type teeProcessor struct{}
+
+func (tp *teeProcessor) Init(cf sputnik.ConfFactory) error {
+	return nil
+}
+
+func (tp *teeProcessor) Process(msg sputnik.Msg) []sputnik.Msg {
+	cpy := Clone(msg)
+	SetTargets(cpy, []string{"archive"})
+	SetPart(cpy, "copy", "true")
+	return []sputnik.Msg{msg, cpy}
+}
+
+func Test_Pipeline(t *testing.T) {
+	RegisterProcessorFactory("test-drop", func() Processor { return new(dropProcessor) })
+	RegisterProcessorFactory("test-tee", func() Processor { return new(teeProcessor) })
+	defer RegisterProcessorFactory("test-drop", nil)
+	defer RegisterProcessorFactory("test-tee", nil)
+
+	for _, workers := range []int{0, 3} {
+		var (
+			lock sync.Mutex
+			sent []map[string]string
+		)
+
+		pl := newPipeline(func(msg sputnik.Msg) {
+			parts, _ := UnpackToMap(msg)
+			Put(msg)
+			lock.Lock()
+			sent = append(sent, parts)
+			lock.Unlock()
+		})
+
+		if err := pl.init([]string{"test-drop", "test-tee"}, nil, workers); err != nil {
+			t.Fatalf("init error %v", err)
+		}
+
+		pl.start()
+
+		for sev := 0; sev < severities; sev++ {
+			parts := makeRFC5424Msg()
+			parts[severityKey] = strconv.Itoa(sev)
+			parts["hostname"] = "host" + strconv.Itoa(sev)
+
+			msg := Get()
+			Pack(msg, parts)
+			pl.push(msg)
+		}
+
+		pl.stop()
+
+		// severities 0-3, every message with copy
+		if len(sent) != 8 {
+			t.Fatalf("workers %d: expected 8 messages actual %d", workers, len(sent))
+		}
+
+		copies := 0
+		for _, parts := range sent {
+			if parts["copy"] == "true" {
+				copies++
+				if parts[targetsPart] != `["archive"]` {
+					t.Errorf("wrong targets of the copy %s", parts[targetsPart])
+				}
+			}
+		}
+
+		if copies != 4 {
+			t.Errorf("workers %d: expected 4 copies actual %d", workers, copies)
+		}
+	}
+
+	pl := newPipeline(nil)
+	if err := pl.init([]string{"not-registered"}, nil, 0); err == nil {
+		t.Errorf("init with not registered processor should fail")
+	}
+}
+
+// Processes message with the parts, returns parts of the single result
+func processParts(t *testing.T, prc Processor, parts map[string]string) map[string]string {
+	msg := Get()
+	if err := Pack(msg, parts); err != nil {
+		t.Fatalf("Pack error %v", err)
+	}
+
+	out := prc.Process(msg)
+	if len(out) != 1 {
+		t.Fatalf("expected 1 message actual %d", len(out))
+	}
+
+	result, err := UnpackToMap(out[0])
+	if err != nil {
+		t.Fatalf("Unpack error %v", err)
+	}
+
+	Put(out[0])
+
+	return result
+}
+
+// Returns factory of configuration with the content for the name
+func testConfFactory(name string, conf any) sputnik.ConfFactory {
+	return func(confName string, result any) error {
+		if confName != name {
+			return fmt.Errorf("unexpected configuration %s", confName)
+		}
+		data, err := json.Marshal(conf)
+		if err != nil {
+			return err
+		}
+		return json.Unmarshal(data, result)
+	}
+}
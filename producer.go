@@ -1,24 +1,108 @@
 package syslogsidecar
 
 import (
-	"sync/atomic"
+	"errors"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/g41797/sputnik"
 	"github.com/g41797/sputnik/sidecar"
 )
 
-func producerBlockFactory() *sputnik.Block {
-	prd := new(producer)
-	if mpf == nil {
+// Configuration of the producer is stored in syslogproducer.json,
+// configuration of named producer - in syslogproducer_<name>.json.
+// The file is optional and may be shared with configuration of
+// broker specific producer.
+type ProducerConfiguration struct {
+	// Number of attempts to produce the message, including the first one.
+	// 0 or 1 - without retries
+	RETRY_ATTEMPTS int
+
+	// Delay before the first retry in milliseconds (default 100).
+	// Every next delay is doubled
+	RETRY_BACKOFF_MS int
+
+	// Max delay between retries in milliseconds
+	RETRY_MAX_BACKOFF_MS int
+
+	// Random part of the delay between retries [0.0:1.0]
+	// e.g. 0.2 - delay is decreased randomly up to 20%
+	RETRY_JITTER float64
+
+	// Number of consecutive failures, which "opens" circuit breaker.
+	// For opened breaker messages are not produced and saved in the spool.
+	// 0 - circuit breaker is not used
+	BREAKER_FAILURES int
+
+	// Time in milliseconds in "open" state (default 1000).
+	// After this time breaker is "half-open": one probe message is produced,
+	// success "closes" the breaker, failure "opens" it again
+	BREAKER_OPEN_MS int
+
+	// Folder of disk spool for messages which cannot be produced:
+	//   - producer is disconnected
+	//   - circuit breaker is open
+	//   - all attempts failed
+	// Spooled messages are produced after successful probe.
+	// For empty string - spool is not used, messages are sent to writer
+	SPOOL_PATH string
+
+	// Max number of messages in the spool. 0 - unlimited
+	SPOOL_MAXMSGS int
+
+	// Number of goroutines producing messages (default 1).
+	// For WORKERS > 1 Produce of MessageProducer is called concurrently
+	WORKERS int
+
+	// Part of the message used for distribution of messages between workers:
+	//	"hostname" (default)
+	//	"app_name" - for RFC3164 messages "tag" is used
+	//	"target"   - the first target of the message (see Targets)
+	// Messages with the same key are produced in order of receiving,
+	// messages with different keys are produced in parallel
+	PARTITION_KEY string
+
+	// Readiness (/readyz) fails if producer is disconnected longer than
+	// READY_DISCONNECTED_MS milliseconds (default 30000)
+	// or used part of the spool is above READY_SPOOL_RATIO [0.0:1.0] (default 0.9)
+	READY_DISCONNECTED_MS int
+	READY_SPOOL_RATIO     float64
+}
+
+// Keys for partitioning of messages between workers
+const (
+	PartitionByHostname = "hostname"
+	PartitionByAppName  = "app_name"
+	PartitionByTarget   = "target"
+)
+
+func readProducerConfiguration(fact sputnik.ConfFactory, name string, conf *ProducerConfiguration) error {
+	err := fact(name, conf)
+
+	if (err == nil) || errors.Is(err, fs.ErrNotExist) {
 		return nil
 	}
 
-	mp := mpf()
-	if mp == nil {
+	return err
+}
+
+func producerBlockFactory() *sputnik.Block {
+	if len(mpfs) == 0 {
 		return nil
 	}
 
-	prd.mp = mp
+	prd := new(producer)
+
+	for _, name := range producerNames() {
+		mp := mpfs[name]()
+		if mp == nil {
+			return nil
+		}
+		prd.nps = append(prd.nps, newNamedProducer(name, mp))
+	}
 
 	block := sputnik.NewBlock(
 		sputnik.WithInit(prd.init),
@@ -39,26 +123,34 @@ func init() {
 	sputnik.RegisterBlockFactory(ProducerName, producerBlockFactory)
 }
 
+// Producer block forwards every message to one or several
+// named producers according to targets of the message
 type producer struct {
-	mp        sidecar.MessageProducer
-	connected atomic.Bool
-	cfact     sputnik.ConfFactory
-	writer    sputnik.BlockCommunicator
-	stop      chan struct{}
-	done      chan struct{}
-	conn      chan sputnik.ServerConnection
-	dscn      chan struct{}
-	mlog      chan sputnik.Msg
+	nps   []*namedProducer
+	cfact sputnik.ConfFactory
+	stop  chan struct{}
+	done  chan struct{}
+	conn  chan sputnik.ServerConnection
+	dscn  chan struct{}
 }
 
 // Init
 func (prd *producer) init(fact sputnik.ConfFactory) error {
 	prd.cfact = fact
+
+	for i, np := range prd.nps {
+		if err := np.init(fact); err != nil {
+			for _, inited := range prd.nps[:i] {
+				inited.spool.close()
+			}
+			return err
+		}
+	}
+
 	prd.stop = make(chan struct{}, 1)
 	prd.done = make(chan struct{}, 1)
 	prd.conn = make(chan sputnik.ServerConnection, 1)
 	prd.dscn = make(chan struct{}, 1)
-	prd.mlog = make(chan sputnik.Msg, 1)
 
 	return nil
 }
@@ -66,6 +158,9 @@ func (prd *producer) init(fact sputnik.ConfFactory) error {
 // Finish:
 func (prd *producer) finish(init bool) {
 	if init {
+		for _, np := range prd.nps {
+			np.spool.close()
+		}
 		return
 	}
 
@@ -89,64 +184,190 @@ func (prd *producer) brokerDisconnected() {
 
 // OnMsg:
 func (prd *producer) logReceived(msg sputnik.Msg) {
-	// For disconnected state - forward to writer:
-	if !prd.connected.Load() {
-		prd.sendToWriter(msg)
+	receivers := prd.route(msg)
+
+	if len(receivers) == 0 {
+		Put(msg)
 		return
 	}
 
-	prd.mlog <- msg
+	for i, np := range receivers {
+		npmsg := msg
+		if i < len(receivers)-1 {
+			npmsg = Clone(msg)
+		}
+		npmsg[producerKey] = np.name
+		np.logReceived(npmsg, prd.stop)
+	}
 	return
 }
 
+// Returns named producers for the message:
+//   - producers of qualified targets ("name:target")
+//   - default producer for unqualified targets or for the message without targets.
+//     If default producer was not registered - all named producers
+func (prd *producer) route(msg sputnik.Msg) []*namedProducer {
+	if len(prd.nps) == 1 {
+		return prd.nps
+	}
+
+	targets, err := targets(msg)
+
+	if (err != nil) || (len(targets) == 0) {
+		return prd.unqualified()
+	}
+
+	names := make(map[string]bool)
+	unqualified := false
+
+	for _, target := range targets {
+		name, _ := splitTarget(target)
+		if len(name) == 0 {
+			unqualified = true
+			continue
+		}
+		names[name] = true
+	}
+
+	var receivers []*namedProducer
+
+	for _, np := range prd.nps {
+		if names[np.name] || (unqualified && np.receivesUnqualified()) {
+			receivers = append(receivers, np)
+		}
+	}
+
+	return receivers
+}
+
+func (prd *producer) unqualified() []*namedProducer {
+	var receivers []*namedProducer
+
+	for _, np := range prd.nps {
+		if np.receivesUnqualified() {
+			receivers = append(receivers, np)
+		}
+	}
+
+	return receivers
+}
+
 // Run
 func (prd *producer) run(bc sputnik.BlockCommunicator) {
 
-	prd.writer, _ = bc.Communicator(WriterResponsibility)
+	writer, _ := bc.Communicator(WriterResponsibility)
 
 	defer close(prd.done)
 
+	ticker := time.NewTicker(spoolDrainInterval)
+	defer ticker.Stop()
+
+	for _, np := range prd.nps {
+		np.start(writer, prd.stop)
+	}
+
 loop:
 	for {
 		select {
 		case <-prd.stop:
 			break loop
 		case sharedconn := <-prd.conn:
-			{
-				err := prd.mp.Connect(prd.cfact, sharedconn)
-				prd.connected.Store(err == nil)
+			for _, np := range prd.nps {
+				np.connect(prd.cfact, sharedconn)
 			}
 		case <-prd.dscn:
-			{
-				if prd.connected.Load() {
-					prd.mp.Disconnect()
-					prd.connected.Store(false)
-				}
+			for _, np := range prd.nps {
+				np.disconnect()
+			}
+		case <-ticker.C:
+			for _, np := range prd.nps {
+				np.drainSpool()
 			}
-		case logmsg := <-prd.mlog:
-			prd.processLog(logmsg)
 		}
 	}
 
-	prd.mp.Disconnect()
+	// Graceful drain: workers process already received messages
+	for _, np := range prd.nps {
+		np.finish()
+		health.remove(np.healthOwner())
+	}
+
+	mProducerChannels.reset()
+	mSpool.reset()
+	mBreaker.reset()
+
 	return
 }
 
-func (prd *producer) processLog(logmsg sputnik.Msg) {
-	if err := prd.mp.Produce(logmsg); err != nil {
-		prd.sendToWriter(logmsg)
+// Registers factory of default producer.
+// Default producer receives messages with unqualified targets,
+// its configuration is stored in syslogproducer.json.
+//
+// Produce of the producer returns the message to the pool (see Put) only on success.
+// After error the message is still used by syslogsidecar (retries, spool, writer),
+// so it should not be returned to the pool or kept by the producer
+func RegisterMessageProducerFactory(fact func() sidecar.MessageProducer) {
+	RegisterNamedMessageProducerFactory("", fact)
+}
+
+// Registers factory of named producer. Several producers may be used simultaneously,
+// e.g. one sidecar produces messages to the broker and to the file archive.
+//
+// Named producer:
+//   - receives messages with targets qualified by the name of the producer,
+//     e.g. "nats:app-critical", "file:/var/log/crit" (see Targets)
+//   - uses own configuration: configuration "conf" requested by the producer
+//     is read from "conf_<name>.json" file, e.g. syslogproducer_file.json
+func RegisterNamedMessageProducerFactory(name string, fact func() sidecar.MessageProducer) {
+	if strings.Contains(name, ":") {
+		panic(fmt.Sprintf("wrong producer name %s", name))
 	}
-	return
+
+	if fact == nil {
+		delete(mpfs, name)
+		return
+	}
+
+	mpfs[name] = fact
 }
 
-func (prd *producer) sendToWriter(logmsg sputnik.Msg) {
-	if prd.writer != nil {
-		prd.writer.Send(logmsg)
+var mpfs = make(map[string]func() sidecar.MessageProducer)
+
+func producerNames() []string {
+	var names []string
+	for name := range mpfs {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	return names
 }
 
-func RegisterMessageProducerFactory(fact func() sidecar.MessageProducer) {
-	mpf = fact
+func isProducerName(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	_, exists := mpfs[name]
+	return exists
+}
+
+// Default producer receives messages with unqualified targets.
+// Without default producer such messages are received by all producers
+func unqualifiedReceiver(name string) bool {
+	if len(name) == 0 {
+		return true
+	}
+	_, exists := mpfs[""]
+	return !exists
 }
 
-var mpf func() sidecar.MessageProducer
+// Splits qualified target "name:target" to the name of producer and target.
+// For unqualified target returns empty name
+func splitTarget(target string) (name string, trgt string) {
+	before, after, found := strings.Cut(target, ":")
+
+	if found && isProducerName(before) {
+		return before, strings.TrimSpace(after)
+	}
+
+	return "", target
+}
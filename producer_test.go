@@ -2,6 +2,8 @@ package syslogsidecar
 
 import (
 	"fmt"
+	"reflect"
+	"testing"
 
 	"github.com/g41797/kissngoqueue"
 	"github.com/g41797/sputnik"
@@ -38,3 +40,103 @@ func (mp *MockMsgProducer) Produce(msg sputnik.Msg) error {
 
 	return fmt.Errorf("q canceled")
 }
+
+func Test_ProducerPartition(t *testing.T) {
+	prd := newNamedProducer("", nil)
+	prd.conf.WORKERS = 4
+	prd.conf.PARTITION_KEY = PartitionByHostname
+	prd.mlogs = make([]chan sputnik.Msg, prd.conf.WORKERS)
+
+	indexes := make(map[string]int)
+
+	for i := 0; i < 100; i++ {
+		parts := makeRFC5424Msg()
+		parts["hostname"] = fmt.Sprintf("host%d", i%10)
+
+		msg := Get()
+		if err := Pack(msg, parts); err != nil {
+			t.Fatalf("Pack error %v", err)
+		}
+
+		indx := prd.partition(msg)
+		Put(msg)
+
+		if (indx < 0) || (indx >= prd.conf.WORKERS) {
+			t.Fatalf("wrong worker index %d", indx)
+		}
+
+		if prev, exists := indexes[parts["hostname"]]; exists && (prev != indx) {
+			t.Fatalf("messages of %s are distributed between workers %d and %d", parts["hostname"], prev, indx)
+		}
+
+		indexes[parts["hostname"]] = indx
+	}
+}
+
+func Test_ProducerRoute(t *testing.T) {
+	saved := mpfs
+	defer func() { mpfs = saved }()
+
+	mpfs = make(map[string]func() sidecar.MessageProducer)
+	RegisterNamedMessageProducerFactory("nats", func() sidecar.MessageProducer { return newMMP(nil) })
+	RegisterNamedMessageProducerFactory("file", func() sidecar.MessageProducer { return newMMP(nil) })
+
+	// Targets are built from test entries instead of syslogconf.json,
+	// finders of syslogconf.json are restored for next tests
+	bfonce.Do(buildFinders)
+	savedFinders, savedError := tFinders, tfError
+	t.Cleanup(func() { tFinders, tfError = savedFinders, savedError })
+
+	tFinders = nil
+	tfError = nil
+	for _, entry := range []slfEntry{
+		{"local0.err,crit", "nats:app-critical"},
+		{"local0.crit", "file:/var/log/crit"},
+		{"err,crit", "common"},
+	} {
+		tf, err := entry.toFinder()
+		if err != nil {
+			t.Fatalf("toFinder error %v", err)
+		}
+		tFinders = append(tFinders, tf)
+	}
+
+	prd := new(producer)
+	for _, name := range producerNames() {
+		prd.nps = append(prd.nps, newNamedProducer(name, mpfs[name]()))
+	}
+
+	parts := makeRFC5424Msg()
+	parts["priority"] = "130" // local0.crit
+
+	msg := Get()
+	defer Put(msg)
+
+	if err := Pack(msg, parts); err != nil {
+		t.Fatalf("Pack error %v", err)
+	}
+
+	receivers := prd.route(msg)
+
+	if len(receivers) != 2 {
+		t.Fatalf("expected 2 receivers actual %d", len(receivers))
+	}
+
+	expected := map[string][]string{
+		"file": {"/var/log/crit", "common"},
+		"nats": {"app-critical", "common"},
+	}
+
+	for _, np := range receivers {
+		msg[producerKey] = np.name
+
+		targets, err := Targets(msg)
+		if err != nil {
+			t.Fatalf("Targets error %v", err)
+		}
+
+		if !reflect.DeepEqual(expected[np.name], targets) {
+			t.Errorf("%s: expected targets %v actual %v", np.name, expected[np.name], targets)
+		}
+	}
+}
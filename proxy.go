@@ -0,0 +1,246 @@
+package syslogsidecar
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// PROXY protocol v1 and v2 (https://www.haproxy.org/download/2.8/doc/proxy-protocol.txt)
+// used by load balancers (HAProxy, AWS NLB) for forwarding of the address of the client
+//
+
+// Max time of receiving of PROXY header
+const proxyHeaderTimeout = 5 * time.Second
+
+// Outcomes of processing of PROXY header
+const (
+	proxyForwarded = "forwarded" // address of the client is used as the source
+	proxyLocal     = "local"     // health check of the load balancer or unknown address
+	proxyInvalid   = "invalid"   // connection is closed
+)
+
+const (
+	proxyV1Prefix    = "PROXY "
+	proxyV1MaxLength = 107
+)
+
+var proxyV2Signature = []byte("\r\n\r\n\x00\r\nQUIT\n")
+
+// PROXY protocol of the listener
+type proxyProtocol struct {
+	trustedNets []netip.Prefix
+}
+
+// Connections from trusted upstreams (list of CIDRs or IP addresses, e.g. "10.0.0.0/8")
+// should start with PROXY header, other connections are processed without header
+func newProxyProtocol(trusted []string) (*proxyProtocol, error) {
+	if len(trusted) == 0 {
+		return nil, fmt.Errorf("list of trusted upstreams of PROXY protocol is empty")
+	}
+
+	nets, err := parseCIDRs(trusted)
+	if err != nil {
+		return nil, err
+	}
+
+	return &proxyProtocol{trustedNets: nets}, nil
+}
+
+func (pp *proxyProtocol) trusted(addr net.Addr) bool {
+	ip, ok := ipOf(addr)
+	if !ok {
+		return false
+	}
+
+	return containsIP(pp.trustedNets, ip)
+}
+
+// Returns prefixes of CIDRs, IP address is converted to the prefix of single address
+func parseCIDRs(list []string) ([]netip.Prefix, error) {
+	var result []netip.Prefix
+
+	for _, cidr := range list {
+		cidr = strings.TrimSpace(cidr)
+
+		if !strings.Contains(cidr, "/") {
+			ip, err := netip.ParseAddr(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("wrong CIDR %s: %v", cidr, err)
+			}
+			result = append(result, netip.PrefixFrom(ip.Unmap(), ip.Unmap().BitLen()))
+			continue
+		}
+
+		prefix, err := netip.ParsePrefix(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("wrong CIDR %s: %v", cidr, err)
+		}
+
+		result = append(result, prefix.Masked())
+	}
+
+	return result, nil
+}
+
+func containsIP(nets []netip.Prefix, ip netip.Addr) bool {
+	for _, prefix := range nets {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns IP address of TCP or UDP address, IPv4-mapped IPv6 address is converted to IPv4
+func ipOf(addr net.Addr) (netip.Addr, bool) {
+	if addr == nil {
+		return netip.Addr{}, false
+	}
+
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.AddrPort().Addr().Unmap(), true
+	case *net.UDPAddr:
+		return a.AddrPort().Addr().Unmap(), true
+	}
+
+	addrPort, err := netip.ParseAddrPort(addr.String())
+	if err != nil {
+		return netip.Addr{}, false
+	}
+
+	return addrPort.Addr().Unmap(), true
+}
+
+// Reads PROXY header (v1 or v2) and returns address of the client, e.g. "192.168.0.1:56324".
+// Empty address for LOCAL command (v2) or UNKNOWN protocol (v1)
+func readProxyHeader(r *bufio.Reader) (string, error) {
+	start, err := r.Peek(len(proxyV2Signature))
+	if err != nil {
+		return "", fmt.Errorf("missing PROXY header: %v", err)
+	}
+
+	if bytes.Equal(start, proxyV2Signature) {
+		return readProxyV2(r)
+	}
+
+	if bytes.HasPrefix(start, []byte(proxyV1Prefix)) {
+		return readProxyV1(r)
+	}
+
+	return "", fmt.Errorf("missing PROXY header")
+}
+
+// "PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n"
+func readProxyV1(r *bufio.Reader) (string, error) {
+	var line []byte
+
+	for {
+		c, err := r.ReadByte()
+		if err != nil {
+			return "", err
+		}
+
+		line = append(line, c)
+
+		if c == '\n' {
+			break
+		}
+
+		if len(line) >= proxyV1MaxLength {
+			return "", fmt.Errorf("too long PROXY header")
+		}
+	}
+
+	if !bytes.HasSuffix(line, []byte("\r\n")) {
+		return "", fmt.Errorf("wrong end of PROXY header")
+	}
+
+	fields := strings.Split(string(line[:len(line)-2]), " ")
+
+	if len(fields) >= 2 && fields[1] == "UNKNOWN" {
+		return "", nil
+	}
+
+	if len(fields) != 6 || (fields[1] != "TCP4" && fields[1] != "TCP6") {
+		return "", fmt.Errorf("wrong PROXY header %q", line)
+	}
+
+	ip, err := netip.ParseAddr(fields[2])
+	if err != nil {
+		return "", fmt.Errorf("wrong source address of PROXY header: %v", err)
+	}
+
+	port, err := strconv.ParseUint(fields[4], 10, 16)
+	if err != nil {
+		return "", fmt.Errorf("wrong source port of PROXY header: %v", err)
+	}
+
+	return netip.AddrPortFrom(ip, uint16(port)).String(), nil
+}
+
+// Binary header: signature, version and command, family, length of addresses,
+// addresses and ports, optional TLVs (ignored)
+func readProxyV2(r *bufio.Reader) (string, error) {
+	var hdr [16]byte
+
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return "", err
+	}
+
+	if version := hdr[12] >> 4; version != 2 {
+		return "", fmt.Errorf("wrong version %d of PROXY header", version)
+	}
+
+	command := hdr[12] & 0x0F
+	family := hdr[13] >> 4
+
+	body := make([]byte, binary.BigEndian.Uint16(hdr[14:16]))
+
+	if _, err := io.ReadFull(r, body); err != nil {
+		return "", err
+	}
+
+	switch command {
+	case 0: // LOCAL
+		return "", nil
+	case 1: // PROXY
+	default:
+		return "", fmt.Errorf("wrong command %d of PROXY header", command)
+	}
+
+	var ip netip.Addr
+	var port uint16
+
+	switch family {
+	case 1: // AF_INET
+		if len(body) < 12 {
+			return "", fmt.Errorf("short IPv4 addresses of PROXY header")
+		}
+		var src [4]byte
+		copy(src[:], body[0:4])
+		ip = netip.AddrFrom4(src)
+		port = binary.BigEndian.Uint16(body[8:10])
+	case 2: // AF_INET6
+		if len(body) < 36 {
+			return "", fmt.Errorf("short IPv6 addresses of PROXY header")
+		}
+		var src [16]byte
+		copy(src[:], body[0:16])
+		ip = netip.AddrFrom16(src)
+		port = binary.BigEndian.Uint16(body[32:34])
+	default: // AF_UNSPEC, AF_UNIX
+		return "", nil
+	}
+
+	return netip.AddrPortFrom(ip, port).String(), nil
+}
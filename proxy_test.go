@@ -0,0 +1,179 @@
+package syslogsidecar
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func proxyV2Header(command byte, family byte, addrs []byte) []byte {
+	var buf bytes.Buffer
+	buf.Write(proxyV2Signature)
+	buf.WriteByte(0x20 | command)
+	buf.WriteByte(family<<4 | 1)
+	binary.Write(&buf, binary.BigEndian, uint16(len(addrs)))
+	buf.Write(addrs)
+	return buf.Bytes()
+}
+
+func Test_ProxyHeader(t *testing.T) {
+	inet := []byte{192, 168, 0, 1, 192, 168, 0, 11, 0xDC, 0x04, 0x01, 0xBB}
+
+	inet6 := make([]byte, 36)
+	inet6[15] = 1
+	inet6[31] = 2
+	binary.BigEndian.PutUint16(inet6[32:], 5141)
+
+	for _, tc := range []struct {
+		header   string
+		expected string
+		fails    bool
+	}{
+		{"PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\r\n", "192.168.0.1:56324", false},
+		{"PROXY TCP6 2001:db8::1 2001:db8::2 56324 443\r\n", "[2001:db8::1]:56324", false},
+		{"PROXY UNKNOWN\r\n", "", false},
+		{"PROXY TCP4 192.168.0.1 192.168.0.11 56324\r\n", "", true},
+		{"PROXY TCP4 192.168.0.1 192.168.0.11 56324 443\n", "", true},
+		{"PROXY TCP4 " + strings.Repeat("1", 120) + "\r\n", "", true},
+		{"<34>1 2003-10-11T22:14:15Z host app - - - text\n", "", true},
+		{string(proxyV2Header(1, 1, inet)), "192.168.0.1:56324", false},
+		{string(proxyV2Header(1, 2, inet6)), "[::1]:5141", false},
+		{string(proxyV2Header(0, 0, nil)), "", false},
+		{string(proxyV2Header(1, 1, inet[:8])), "", true},
+		{string(proxyV2Header(2, 1, inet)), "", true},
+	} {
+		r := bufio.NewReader(strings.NewReader(tc.header + "<34>1 - host app - - - text\n"))
+
+		actual, err := readProxyHeader(r)
+		if (err != nil) != tc.fails {
+			t.Errorf("%q: unexpected error %v", tc.header, err)
+			continue
+		}
+
+		if actual != tc.expected {
+			t.Errorf("%q: expected %s actual %s", tc.header, tc.expected, actual)
+		}
+
+		if tc.fails {
+			continue
+		}
+
+		if rest, _ := r.ReadString('\n'); !strings.HasPrefix(rest, "<34>") {
+			t.Errorf("%q: header is not consumed: %q", tc.header, rest)
+		}
+	}
+
+	if _, err := parseCIDRs([]string{"10.0.0.0/33"}); err == nil {
+		t.Errorf("wrong CIDR should fail")
+	}
+
+	if _, err := newProxyProtocol(nil); err == nil {
+		t.Errorf("PROXY protocol without trusted upstreams should fail")
+	}
+}
+
+func Test_ProxyListener(t *testing.T) {
+	for _, tc := range []struct {
+		trusted  string
+		header   string
+		expected string
+	}{
+		{"127.0.0.0/8", "PROXY TCP4 192.168.0.1 127.0.0.1 56324 5171\r\n", "192.168.0.1:56324"},
+		{"10.0.0.0/8", "", "127.0.0.1:"},
+	} {
+		received := make(logPartsChannel, 1)
+
+		form, _ := formatOfListener(nil, "tcp", "127.0.0.1:5171", false)
+		ss := newStreamServer(listenerName("tcp", "127.0.0.1:5171"), form, received)
+
+		proxy, err := newProxyProtocol([]string{tc.trusted})
+		if err != nil {
+			t.Fatalf("newProxyProtocol error %v", err)
+		}
+		ss.setProxy(proxy)
+
+		if err = ss.Listen("tcp", "127.0.0.1:5171"); err != nil {
+			t.Fatalf("Listen error %v", err)
+		}
+
+		ss.Boot()
+
+		conn, err := net.Dial("tcp", "127.0.0.1:5171")
+		if err != nil {
+			t.Fatalf("Dial error %v", err)
+		}
+
+		conn.Write([]byte(tc.header + "<34>1 2003-10-11T22:14:15.003Z mymachine su - ID47 - proxied\n"))
+
+		logParts := <-received
+
+		if client := logParts["client"].(string); !strings.HasPrefix(client, tc.expected) {
+			t.Errorf("%s: expected client %s actual %s", tc.trusted, tc.expected, client)
+		}
+
+		if logParts["message"] != "proxied" {
+			t.Errorf("wrong parsing %v", logParts)
+		}
+
+		conn.Close()
+		ss.Kill()
+		ss.Wait()
+	}
+}
+
+func Test_ProxyLocalAccess(t *testing.T) {
+	received := make(logPartsChannel, 1)
+
+	name := listenerName("tcp", "127.0.0.1:5172")
+	form, _ := formatOfListener(nil, "tcp", "127.0.0.1:5172", false)
+	ss := newStreamServer(name, form, received)
+
+	proxy, _ := newProxyProtocol([]string{"127.0.0.0/8"})
+	ss.setProxy(proxy)
+
+	access, err := newAccessList([]AccessConfiguration{{DENY: []string{"127.0.0.0/8"}}}, "tcp", "127.0.0.1:5172", nil)
+	if err != nil {
+		t.Fatalf("newAccessList error %v", err)
+	}
+	ss.setAccess(access)
+
+	if err = ss.Listen("tcp", "127.0.0.1:5172"); err != nil {
+		t.Fatalf("Listen error %v", err)
+	}
+
+	ss.Boot()
+	defer func() {
+		ss.Kill()
+		ss.Wait()
+	}()
+
+	rejected := mAccessRejected.value(name)
+
+	conn, err := net.Dial("tcp", "127.0.0.1:5172")
+	if err != nil {
+		t.Fatalf("Dial error %v", err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("PROXY UNKNOWN\r\n<34>1 2003-10-11T22:14:15.003Z mymachine su - ID47 - local\n"))
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err = conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("denied upstream of LOCAL connection should be closed, read result %v", err)
+	}
+
+	if actual := mAccessRejected.value(name); actual != rejected+1 {
+		t.Errorf("expected %d rejected actual %d", rejected+1, actual)
+	}
+
+	select {
+	case logParts := <-received:
+		t.Errorf("message of denied upstream was received %v", logParts)
+	default:
+	}
+}
@@ -0,0 +1,328 @@
+package syslogsidecar
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/g41797/sputnik"
+)
+
+// Name of rate limiting processor and its configuration (ratelimit.json)
+const RateLimitName = "ratelimit"
+
+// Configuration of rate limiting processor is stored in ratelimit.json
+type RateLimitConfiguration struct {
+	// Messages are limited separately for every value of the key:
+	//	"source"   (default) - IP address of the sender (see Source)
+	//	"hostname"
+	//	"app_name" - for RFC3164 messages "tag" is used
+	KEY string
+
+	// Budgets of the key, message is limited by the first matched budget.
+	// Messages which do not match any budget are not limited.
+	// Messages with severity emerg and alert are never limited
+	LIMITS []RateLimit
+
+	// Interval of notices "N messages dropped from X" in milliseconds (default 10000)
+	NOTICE_INTERVAL_MS int
+
+	// Max number of tracked keys (default 10000).
+	// Keys above the limit share the same budgets
+	MAX_KEYS int
+}
+
+// Token bucket budget
+type RateLimit struct {
+	// Selects messages by facility and severity, syntax is the same as in syslogconf.json,
+	// e.g. "warning,notice,info,debug". Empty - all messages
+	SELECTOR string
+
+	// Messages per second
+	RATE float64
+
+	// Max number of messages sent without limit after idle period (default RATE, at least 1)
+	BURST int
+}
+
+// Keys of rate limiting
+const (
+	RateLimitBySource   = "source"
+	RateLimitByHostname = "hostname"
+	RateLimitByAppName  = "app_name"
+)
+
+// Extra parts of notice message
+const (
+	DroppedCountPart = "dropped_count"
+	DroppedFromPart  = "dropped_from"
+)
+
+const (
+	defaultNoticeInterval = 10 * time.Second
+	defaultRateLimitKeys  = 10000
+
+	// Key of the budgets shared by keys above MAX_KEYS
+	overflowKey = "other"
+)
+
+type rateBudget struct {
+	selector *msgSelector
+	rate     float64
+	burst    float64
+}
+
+type tokenBucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+// Takes token for the message, returns false for empty bucket
+func (tb *tokenBucket) take(budget *rateBudget, now time.Time) bool {
+	if tb.updated.IsZero() {
+		tb.tokens = budget.burst
+	} else {
+		tb.tokens += now.Sub(tb.updated).Seconds() * budget.rate
+		if tb.tokens > budget.burst {
+			tb.tokens = budget.burst
+		}
+	}
+	tb.updated = now
+
+	if tb.tokens < 1 {
+		return false
+	}
+
+	tb.tokens--
+	return true
+}
+
+// Buckets and counter of dropped messages of the key
+type limitedKey struct {
+	buckets []tokenBucket
+	dropped int
+	seen    time.Time
+}
+
+type rateLimiter struct {
+	conf     RateLimitConfiguration
+	budgets  []rateBudget
+	interval time.Duration
+	hostname string
+	tsFormat string
+	tsUTC    bool
+
+	lock   sync.Mutex
+	keys   map[string]*limitedKey
+	notice time.Time
+	now    func() time.Time
+}
+
+func newRateLimiter() Processor {
+	return &rateLimiter{keys: make(map[string]*limitedKey), now: time.Now}
+}
+
+func init() {
+	RegisterProcessorFactory(RateLimitName, newRateLimiter)
+}
+
+func (rl *rateLimiter) setTimestampFormat(form string, utc bool) {
+	rl.tsFormat, rl.tsUTC = form, utc
+}
+
+func (rl *rateLimiter) Init(cf sputnik.ConfFactory) error {
+	if err := cf(RateLimitName, &rl.conf); err != nil {
+		return err
+	}
+
+	switch rl.conf.KEY {
+	case "":
+		rl.conf.KEY = RateLimitBySource
+	case RateLimitBySource, RateLimitByHostname, RateLimitByAppName:
+	default:
+		return fmt.Errorf("wrong rate limit key %s", rl.conf.KEY)
+	}
+
+	if len(rl.conf.LIMITS) == 0 {
+		return fmt.Errorf("empty list of rate limits")
+	}
+
+	for i, lconf := range rl.conf.LIMITS {
+		if lconf.RATE <= 0 {
+			return fmt.Errorf("rate limit %d: RATE should be positive", i)
+		}
+
+		budget := rateBudget{rate: lconf.RATE, burst: float64(lconf.BURST)}
+
+		if lconf.BURST <= 0 {
+			budget.burst = lconf.RATE
+		}
+		if budget.burst < 1 {
+			budget.burst = 1
+		}
+
+		if len(lconf.SELECTOR) > 0 {
+			selector, err := newMsgSelector(lconf.SELECTOR)
+			if err != nil {
+				return fmt.Errorf("rate limit %d: %v", i, err)
+			}
+			budget.selector = selector
+		}
+
+		rl.budgets = append(rl.budgets, budget)
+	}
+
+	rl.interval = defaultNoticeInterval
+	if rl.conf.NOTICE_INTERVAL_MS > 0 {
+		rl.interval = time.Duration(rl.conf.NOTICE_INTERVAL_MS) * time.Millisecond
+	}
+
+	if rl.conf.MAX_KEYS <= 0 {
+		rl.conf.MAX_KEYS = defaultRateLimitKeys
+	}
+
+	rl.hostname, _ = os.Hostname()
+	rl.notice = rl.now()
+
+	return nil
+}
+
+func (rl *rateLimiter) Process(msg sputnik.Msg) []sputnik.Msg {
+	severity, _ := Part(msg, severityKey)
+	if severity == "0" || severity == "1" {
+		return []sputnik.Msg{msg}
+	}
+
+	index := rl.budgetOf(msg)
+	if index < 0 {
+		return []sputnik.Msg{msg}
+	}
+
+	key := rl.keyOf(msg)
+	now := rl.now()
+
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	lk, exists := rl.keys[key]
+	if !exists {
+		if len(rl.keys) >= rl.conf.MAX_KEYS {
+			key = overflowKey
+			lk = rl.keys[key]
+		}
+		if lk == nil {
+			lk = &limitedKey{buckets: make([]tokenBucket, len(rl.budgets))}
+			rl.keys[key] = lk
+		}
+	}
+
+	lk.seen = now
+
+	if lk.buckets[index].take(&rl.budgets[index], now) {
+		return []sputnik.Msg{msg}
+	}
+
+	lk.dropped++
+	mRateLimited.inc(severity)
+	Put(msg)
+
+	return nil
+}
+
+// Sends notices about dropped messages and removes idle keys
+func (rl *rateLimiter) Flush(final bool) []sputnik.Msg {
+	now := rl.now()
+
+	rl.lock.Lock()
+	defer rl.lock.Unlock()
+
+	if !final && (now.Sub(rl.notice) < rl.interval) {
+		return nil
+	}
+
+	rl.notice = now
+
+	var result []sputnik.Msg
+
+	for _, key := range sortedKeys(rl.keys) {
+		lk := rl.keys[key]
+
+		if lk.dropped > 0 {
+			if notice := rl.newNotice(key, lk.dropped, now); notice != nil {
+				result = append(result, notice)
+			}
+			lk.dropped = 0
+			continue
+		}
+
+		if now.Sub(lk.seen) >= rl.interval {
+			delete(rl.keys, key)
+		}
+	}
+
+	return result
+}
+
+// Index of the first matched budget, -1 for non-limited message
+func (rl *rateLimiter) budgetOf(msg sputnik.Msg) int {
+	for i := range rl.budgets {
+		if rl.budgets[i].selector.match(msg) {
+			return i
+		}
+	}
+	return -1
+}
+
+func (rl *rateLimiter) keyOf(msg sputnik.Msg) string {
+	var key string
+
+	switch rl.conf.KEY {
+	case RateLimitByHostname:
+		key, _ = Part(msg, "hostname")
+	case RateLimitByAppName:
+		key, _ = Part(msg, "app_name")
+		if len(key) == 0 {
+			key, _ = Part(msg, rfc3164OnlyKey)
+		}
+	default:
+		key, _ = Source(msg)
+	}
+
+	return key
+}
+
+// Creates RFC5424 message syslog.warning "N messages dropped from X"
+func (rl *rateLimiter) newNotice(key string, dropped int, now time.Time) sputnik.Msg {
+	from := key
+	if len(from) == 0 {
+		from = "unknown " + rl.conf.KEY
+	}
+
+	parts := map[string]string{
+		rfcFormatKey:     rfc5424,
+		"priority":       strconv.Itoa(5*8 + 4),
+		"facility":       "5",
+		severityKey:      "4",
+		"version":        "1",
+		"timestamp":      formatTime(now, "", rl.tsFormat, rl.tsUTC),
+		"hostname":       rl.hostname,
+		"app_name":       "syslogsidecar",
+		"proc_id":        strconv.Itoa(os.Getpid()),
+		"msg_id":         RateLimitName,
+		rfc5424OnlyKey:   "-",
+		"message":        fmt.Sprintf("%d messages dropped from %s", dropped, from),
+		DroppedCountPart: strconv.Itoa(dropped),
+		DroppedFromPart:  key,
+	}
+
+	msg := Get()
+
+	if err := Pack(msg, parts); err != nil {
+		Put(msg)
+		return nil
+	}
+
+	return msg
+}
@@ -0,0 +1,128 @@
+package syslogsidecar
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/g41797/go-syslog/format"
+	"github.com/g41797/sputnik"
+)
+
+// Packs RFC5424 message with the severity received from the client
+func sourceMsg(client string, severity int) sputnik.Msg {
+	parts := makeRFC5424Msg()
+	parts["priority"] = strconv.Itoa(8 + severity)
+	parts[severityKey] = strconv.Itoa(severity)
+
+	msg := Get()
+	Pack(msg, parts)
+	setSource(msg, format.LogParts{"client": client + ":514", listenerKey: "udp/127.0.0.1:5141"})
+	return msg
+}
+
+func Test_RateLimit(t *testing.T) {
+	conf := RateLimitConfiguration{
+		LIMITS: []RateLimit{
+			{SELECTOR: "info,debug", RATE: 1, BURST: 2},
+			{SELECTOR: "warning,notice", RATE: 10},
+		},
+		NOTICE_INTERVAL_MS: 5000,
+	}
+
+	// Timestamps of notices are formatted like timestamps of received messages
+	pl := newPipeline(nil)
+	pl.tsFormat, pl.tsUTC = TimestampUnixMs, true
+	if err := pl.init([]string{RateLimitName}, testConfFactory(RateLimitName, conf), 0); err != nil {
+		t.Fatalf("init error %v", err)
+	}
+
+	prc := pl.processors[0]
+	rl := prc.(*rateLimiter)
+	now := time.Now()
+	rl.now = func() time.Time { return now }
+	rl.notice = now
+
+	passed := func(client string, severity int, count int) int {
+		result := 0
+		for i := 0; i < count; i++ {
+			out := prc.Process(sourceMsg(client, severity))
+			result += len(out)
+			for _, msg := range out {
+				Put(msg)
+			}
+		}
+		return result
+	}
+
+	if n := passed("10.0.0.1", 6, 5); n != 2 {
+		t.Errorf("info: expected 2 messages (burst) actual %d", n)
+	}
+
+	if n := passed("10.0.0.1", 5, 5); n != 5 {
+		t.Errorf("notice: separate budget, expected 5 actual %d", n)
+	}
+
+	if n := passed("10.0.0.1", 1, 20); n != 20 {
+		t.Errorf("alert should not be limited, actual %d", n)
+	}
+
+	if n := passed("10.0.0.1", 3, 20); n != 20 {
+		t.Errorf("err without budget should not be limited, actual %d", n)
+	}
+
+	if n := passed("10.0.0.2", 7, 3); n != 2 {
+		t.Errorf("another source: expected 2 messages actual %d", n)
+	}
+
+	if out := rl.Flush(false); len(out) != 0 {
+		t.Fatalf("notice before the interval")
+	}
+
+	now = now.Add(5 * time.Second)
+
+	if n := passed("10.0.0.1", 6, 6); n != 2 {
+		t.Errorf("info after 5s: expected 2 messages actual %d", n)
+	}
+
+	out := rl.Flush(false)
+	if len(out) != 2 {
+		t.Fatalf("expected 2 notices actual %d", len(out))
+	}
+
+	checkPart(t, out[0], "message", "7 messages dropped from 10.0.0.1", true)
+	checkPart(t, out[0], DroppedCountPart, "7", true)
+	checkPart(t, out[0], "timestamp", strconv.FormatInt(now.UnixMilli(), 10), true)
+	checkPart(t, out[1], "message", "1 messages dropped from 10.0.0.2", true)
+
+	for _, msg := range out {
+		Put(msg)
+	}
+
+	now = now.Add(5 * time.Second)
+
+	if out := rl.Flush(false); len(out) != 0 {
+		t.Errorf("unexpected notices %d", len(out))
+	}
+
+	if len(rl.keys) != 0 {
+		t.Errorf("idle keys were not removed")
+	}
+}
+
+// Pending notice is sent to the producer on stop of the receiver
+func Test_RateLimitOnStop(t *testing.T) {
+	conf := RateLimitConfiguration{
+		KEY:                RateLimitByHostname,
+		LIMITS:             []RateLimit{{RATE: 1, BURST: 1}},
+		NOTICE_INTERVAL_MS: 60000,
+	}
+
+	line := "<134>1 2003-10-11T22:14:15.003Z mymachine app - - - chatty"
+
+	texts := receiveAndStop(t, RateLimitName, conf, []string{line, line, line})
+
+	if len(texts) != 2 || texts[0] != "chatty" || texts[1] != "2 messages dropped from mymachine" {
+		t.Errorf("wrong messages %q", texts)
+	}
+}
@@ -52,6 +52,10 @@ func (rcv *receiver) init(fact sputnik.ConfFactory) error {
 
 	syslogd := newServer(rcv.conf)
 
+	if err := syslogd.initPipeline(fact); err != nil {
+		return err
+	}
+
 	if err := syslogd.initServer(); err != nil {
 		return err
 	}
@@ -80,6 +84,14 @@ func (rcv *receiver) finish(init bool) {
 // Run:
 func (rcv *receiver) run(bc sputnik.BlockCommunicator) {
 
+	producer, exists := bc.Communicator(ProducerResponsibility)
+	if !exists {
+		panic("Syslog producer block does not exists")
+	}
+
+	rcv.producer = producer
+	rcv.syslogd.setupHandling(rcv.producer)
+
 	err := rcv.syslogd.start()
 	if err != nil {
 		panic(err)
@@ -90,14 +102,6 @@ func (rcv *receiver) run(bc sputnik.BlockCommunicator) {
 	rcv.done = make(chan struct{})
 	defer close(rcv.done)
 
-	producer, exists := bc.Communicator(ProducerResponsibility)
-	if !exists {
-		panic("Syslog producer block does not exists")
-	}
-
-	rcv.producer = producer
-	rcv.syslogd.setupHandling(rcv.producer)
-
 	<-rcv.stop
 
 	return
@@ -113,8 +117,9 @@ func (rcv *receiver) stopSyslog() {
 		return
 	}
 
-	rcv.syslogd.setupHandling(nil)
+	// Messages flushed during stop are sent to the producer
 	rcv.syslogd.stop()
+	rcv.syslogd.setupHandling(nil)
 
 	return
 }
@@ -2,6 +2,7 @@ package syslogsidecar
 
 import (
 	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -241,3 +242,65 @@ func TestReceive_Exchange(t *testing.T) {
 
 	return
 }
+
+// Collects texts of messages sent to the producer
+type sentTexts struct {
+	lock  sync.Mutex
+	texts []string
+}
+
+func (cl *sentTexts) Communicator(resp string) (bc sputnik.BlockCommunicator, exists bool) {
+	return nil, false
+}
+
+func (cl *sentTexts) Descriptor() sputnik.BlockDescriptor {
+	return sputnik.BlockDescriptor{}
+}
+
+func (cl *sentTexts) Send(msg sputnik.Msg) bool {
+	parts, _ := UnpackToMap(msg)
+	Put(msg)
+
+	cl.lock.Lock()
+	defer cl.lock.Unlock()
+
+	cl.texts = append(cl.texts, parts[messagePartOf(parts)])
+
+	return true
+}
+
+// Runs receiver with the processor, handles lines as received by TCP listener,
+// stops the receiver and returns texts of messages sent to the producer
+func receiveAndStop(t *testing.T, processor string, conf any, lines []string) []string {
+	srvconf := SyslogConfiguration{SEVERITYLEVEL: 7, PROCESSORS: []string{processor}}
+
+	srv := newServer(srvconf)
+	if err := srv.initPipeline(testConfFactory(processor, conf)); err != nil {
+		t.Fatalf("initPipeline error %v", err)
+	}
+	if err := srv.initServer(); err != nil {
+		t.Fatalf("initServer error %v", err)
+	}
+
+	producer := new(sentTexts)
+	srv.setupHandling(producer)
+
+	if err := srv.start(); err != nil {
+		t.Fatalf("start error %v", err)
+	}
+
+	form, _ := formatOfListener(nil, "tcp", "127.0.0.1:5141", false)
+	handler := &listenerHandler{srv, listenerName("tcp", "127.0.0.1:5141")}
+
+	for _, line := range lines {
+		parseLine(form, handler, []byte(line), "127.0.0.1:40000", "")
+	}
+
+	rcv := &receiver{syslogd: srv}
+	rcv.stopSyslog()
+
+	producer.lock.Lock()
+	defer producer.lock.Unlock()
+
+	return producer.texts
+}
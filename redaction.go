@@ -0,0 +1,353 @@
+package syslogsidecar
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+
+	"github.com/g41797/sputnik"
+)
+
+// Name of redaction processor and its configuration (redaction.json)
+const RedactionName = "redaction"
+
+// Configuration of redaction processor is stored in redaction.json
+type RedactionConfiguration struct {
+	RULES []RedactionRule
+
+	// Replacement for "mask" action (default "***")
+	MASK string
+
+	// Key of HMAC-SHA256 for "hash" action. Equal values have equal hashes,
+	// without the key hashes of short values (e.g. IPs) may be reversed
+	HASH_KEY string
+}
+
+// Rule of redaction. One of PATTERN, KEYWORDS or BUILTIN should be used
+type RedactionRule struct {
+	// Name of the rule used as label of metric syslogsidecar_redactions_total
+	NAME string
+
+	// Regular expression (RE2 syntax https://github.com/google/re2/wiki/Syntax).
+	// If expression contains capturing group - only text of the first group is redacted,
+	// e.g. "password=(\\S+)"
+	PATTERN string
+
+	// Words redacted case-insensitively
+	KEYWORDS []string
+
+	// Predefined pattern:
+	//	"email"
+	//	"ipv4"
+	//	"ipv6"   - addresses with at least two groups of hex digits
+	//	"card"   - payment card numbers, validated by Luhn algorithm.
+	//	           Numbers without separators should have prefix of payment card (2-6)
+	//	"bearer" - token of "Bearer" authorization
+	BUILTIN string
+
+	// "mask" (default) - replace by MASK
+	// "hash" - replace by "sha256:" and 16 hex digits of HMAC-SHA256 of redacted text
+	ACTION string
+
+	// Redacted parts: "message", "content", "structured_data" (default all).
+	// Another parts (e.g. added by processors) also may be used
+	PARTS []string
+}
+
+// Actions of redaction
+const (
+	RedactMask = "mask"
+	RedactHash = "hash"
+)
+
+var builtinPatterns = map[string]string{
+	"email":  `[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`,
+	"ipv4":   `\b(?:(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\.){3}(?:25[0-5]|2[0-4]\d|1\d\d|[1-9]?\d)\b`,
+	"ipv6":   `(?i)\b(?:[0-9a-f]{1,4}:){7}[0-9a-f]{1,4}\b|\b(?:[0-9a-f]{1,4}:){1,7}:(?:[0-9a-f]{1,4}(?::[0-9a-f]{1,4}){0,6}\b)?`,
+	"card":   `\b\d{4}[ \-]\d{4,6}[ \-]\d{4,5}(?:[ \-]\d{1,4}){0,2}\b|\b\d{13,19}\b`,
+	"bearer": `(?i)\bbearer\s+([A-Za-z0-9\-._~+/]+=*)`,
+}
+
+var defaultRedactedParts = []string{"message", "content", rfc5424OnlyKey}
+
+type redactionRule struct {
+	name   string
+	re     *regexp.Regexp
+	valid  func(string) bool
+	hash   bool
+	inPart map[string]bool
+}
+
+type redactor struct {
+	conf  RedactionConfiguration
+	rules []*redactionRule
+	parts []string
+}
+
+func newRedactor() Processor {
+	return new(redactor)
+}
+
+func init() {
+	RegisterProcessorFactory(RedactionName, newRedactor)
+}
+
+func (rd *redactor) Init(cf sputnik.ConfFactory) error {
+	if err := cf(RedactionName, &rd.conf); err != nil {
+		return err
+	}
+
+	if len(rd.conf.MASK) == 0 {
+		rd.conf.MASK = "***"
+	}
+
+	if len(rd.conf.RULES) == 0 {
+		return fmt.Errorf("empty list of redaction rules")
+	}
+
+	used := make(map[string]bool)
+
+	for i, rconf := range rd.conf.RULES {
+		rule, err := newRedactionRule(rconf)
+		if err != nil {
+			return fmt.Errorf("redaction rule %d: %v", i, err)
+		}
+
+		if len(rule.name) == 0 {
+			rule.name = rconf.BUILTIN
+		}
+		if len(rule.name) == 0 {
+			rule.name = fmt.Sprintf("rule%d", i)
+		}
+
+		rd.rules = append(rd.rules, rule)
+
+		for part := range rule.inPart {
+			if !used[part] {
+				used[part] = true
+				rd.parts = append(rd.parts, part)
+			}
+		}
+	}
+
+	return nil
+}
+
+func newRedactionRule(rconf RedactionRule) (*redactionRule, error) {
+	rule := new(redactionRule)
+	rule.name = rconf.NAME
+
+	pattern := rconf.PATTERN
+
+	switch {
+	case len(rconf.BUILTIN) > 0:
+		builtin, exists := builtinPatterns[rconf.BUILTIN]
+		if !exists {
+			return nil, fmt.Errorf("unknown builtin pattern %s", rconf.BUILTIN)
+		}
+		pattern = builtin
+		switch rconf.BUILTIN {
+		case "card":
+			rule.valid = cardValid
+		case "ipv6":
+			rule.valid = ipv6Valid
+		}
+	case len(rconf.KEYWORDS) > 0:
+		words := make([]string, len(rconf.KEYWORDS))
+		for i, word := range rconf.KEYWORDS {
+			words[i] = regexp.QuoteMeta(word)
+		}
+		pattern = "(?i)" + strings.Join(words, "|")
+	}
+
+	if len(pattern) == 0 {
+		return nil, fmt.Errorf("PATTERN, KEYWORDS or BUILTIN should be used")
+	}
+
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	rule.re = re
+
+	switch rconf.ACTION {
+	case "", RedactMask:
+	case RedactHash:
+		rule.hash = true
+	default:
+		return nil, fmt.Errorf("wrong action %s", rconf.ACTION)
+	}
+
+	parts := rconf.PARTS
+	if len(parts) == 0 {
+		parts = defaultRedactedParts
+	}
+
+	rule.inPart = make(map[string]bool)
+	for _, part := range parts {
+		rule.inPart[part] = true
+	}
+
+	return rule, nil
+}
+
+func (rd *redactor) Process(msg sputnik.Msg) []sputnik.Msg {
+	parts, err := UnpackToMap(msg)
+	if err != nil {
+		return []sputnik.Msg{msg}
+	}
+
+	changed := false
+
+	for _, part := range rd.parts {
+		val, exists := parts[part]
+		if !exists || len(val) == 0 {
+			continue
+		}
+
+		redacted := val
+		for _, rule := range rd.rules {
+			if rule.inPart[part] {
+				redacted = rd.redact(rule, part, redacted)
+			}
+		}
+
+		if redacted != val {
+			parts[part] = redacted
+			changed = true
+		}
+	}
+
+	if changed {
+		Pack(msg, parts)
+	}
+
+	return []sputnik.Msg{msg}
+}
+
+// Replaces all matches of the rule (or text of the first capturing group)
+func (rd *redactor) redact(rule *redactionRule, part string, text string) string {
+	matches := rule.re.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+
+	var sb strings.Builder
+	last := 0
+
+	for _, match := range matches {
+		start, end := match[0], match[1]
+		if len(match) >= 4 && match[2] >= 0 {
+			start, end = match[2], match[3]
+		}
+
+		found := text[start:end]
+
+		if rule.valid != nil && !rule.valid(found) {
+			continue
+		}
+
+		replacement := rd.replacement(rule, found)
+		if part == rfc5424OnlyKey {
+			replacement = escapeSDValue(replacement)
+		}
+
+		sb.WriteString(text[last:start])
+		sb.WriteString(replacement)
+		last = end
+
+		mRedactions.inc(rule.name, part)
+	}
+
+	if last == 0 {
+		return text
+	}
+
+	sb.WriteString(text[last:])
+
+	return sb.String()
+}
+
+func (rd *redactor) replacement(rule *redactionRule, found string) string {
+	if !rule.hash {
+		return rd.conf.MASK
+	}
+
+	mac := hmac.New(sha256.New, []byte(rd.conf.HASH_KEY))
+	mac.Write([]byte(found))
+
+	return "sha256:" + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// Escapes characters of PARAM-VALUE of structured data (RFC5424 6.3.3)
+func escapeSDValue(val string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(val)
+}
+
+// Validates number of payment card. Digits without separators
+// (e.g. unix time in milliseconds) are accepted only with prefix of payment card
+func cardValid(number string) bool {
+	if !luhnValid(number) {
+		return false
+	}
+
+	if strings.ContainsAny(number, " -") {
+		return true
+	}
+
+	switch number[0] {
+	case '3', '4', '5', '6':
+		return true
+	case '2':
+		// Mastercard 2221-2720
+		prefix := number[:4]
+		return prefix >= "2221" && prefix <= "2720"
+	}
+
+	return false
+}
+
+// Validates IPv6 address, addresses with one group of hex digits
+// (e.g. "add::" of C++ names) are not accepted
+func ipv6Valid(text string) bool {
+	addr, err := netip.ParseAddr(text)
+	if err != nil || !addr.Is6() {
+		return false
+	}
+
+	groups := strings.FieldsFunc(text, func(r rune) bool { return r == ':' })
+
+	return len(groups) >= 2
+}
+
+// https://en.wikipedia.org/wiki/Luhn_algorithm
+func luhnValid(number string) bool {
+	sum := 0
+	digits := 0
+	double := false
+
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+
+		sum += d
+		digits++
+		double = !double
+	}
+
+	return digits >= 13 && sum%10 == 0
+}
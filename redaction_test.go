@@ -0,0 +1,92 @@
+package syslogsidecar
+
+import (
+	"strings"
+	"testing"
+)
+
+// Processes RFC5424 message with the text and structured data
+func processText(t *testing.T, prc Processor, message string, sd string) map[string]string {
+	parts := makeRFC5424Msg()
+	parts["message"] = message
+	parts[rfc5424OnlyKey] = sd
+
+	return processParts(t, prc, parts)
+}
+
+func Test_Redaction(t *testing.T) {
+	conf := RedactionConfiguration{
+		RULES: []RedactionRule{
+			{BUILTIN: "email"},
+			{BUILTIN: "card"},
+			{BUILTIN: "bearer", ACTION: RedactHash},
+			{NAME: "secret", KEYWORDS: []string{"Project-X"}},
+			{NAME: "password", PATTERN: `password="([^"]*)"`, PARTS: []string{rfc5424OnlyKey}},
+		},
+		MASK:     "[hidden]",
+		HASH_KEY: "key",
+	}
+
+	prc := newRedactor()
+	if err := prc.Init(testConfFactory(RedactionName, conf)); err != nil {
+		t.Fatalf("Init error %v", err)
+	}
+
+	before := mRedactions.value("email", "message")
+
+	result := processText(t, prc,
+		"user john@example.com paid by 4111 1111 1111 1111 (not 4111 1111 1111 1112) for project-x, Authorization: Bearer abc.def",
+		`[auth password="s3cret"]`)
+
+	expected := "user [hidden] paid by [hidden] (not 4111 1111 1111 1112) for [hidden], Authorization: Bearer sha256:"
+	if !strings.HasPrefix(result["message"], expected) {
+		t.Errorf("Expected %s Actual %s", expected, result["message"])
+	}
+
+	if strings.Contains(result["message"], "abc.def") {
+		t.Errorf("bearer token was not redacted %s", result["message"])
+	}
+
+	if result[rfc5424OnlyKey] != `[auth password="[hidden\]"]` {
+		t.Errorf("wrong redaction of structured data %s", result[rfc5424OnlyKey])
+	}
+
+	if mRedactions.value("email", "message") != before+1 {
+		t.Errorf("redaction was not counted")
+	}
+
+	again := processText(t, prc, "Bearer abc.def", "-")
+	if again["message"] != result["message"][strings.Index(result["message"], "Bearer"):] {
+		t.Errorf("hash of the same value should be the same: %s", again["message"])
+	}
+
+	if err := newRedactor().Init(testConfFactory(RedactionName, RedactionConfiguration{
+		RULES: []RedactionRule{{BUILTIN: "phone"}},
+	})); err == nil {
+		t.Errorf("unknown builtin pattern should fail")
+	}
+}
+
+// Builtin patterns do not redact similar tokens
+func Test_RedactionFalsePositives(t *testing.T) {
+	conf := RedactionConfiguration{
+		RULES: []RedactionRule{{BUILTIN: "ipv6"}, {BUILTIN: "card"}},
+	}
+
+	prc := newRedactor()
+	if err := prc.Init(testConfFactory(RedactionName, conf)); err != nil {
+		t.Fatalf("Init error %v", err)
+	}
+
+	for _, tc := range []struct{ text, expected string }{
+		{"calls add:: and add::foo at 12:30", "calls add:: and add::foo at 12:30"},
+		{"from 2001:db8::1 and fe80::1:2", "from *** and ***"},
+		{"at 1718000000006 ms", "at 1718000000006 ms"},
+		{"card 4111111111111111 or 4111-1111-1111-1111", "card *** or ***"},
+		{"amex 3782 822463 10005", "amex ***"},
+	} {
+		if result := processText(t, prc, tc.text, "-"); result["message"] != tc.expected {
+			t.Errorf("Expected %q Actual %q", tc.expected, result["message"])
+		}
+	}
+}
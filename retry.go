@@ -0,0 +1,145 @@
+package syslogsidecar
+
+import (
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// Producer may return errors implementing RetryableError
+// for control of retries.
+// Errors that don't implement RetryableError are considered transient
+// and Produce of the message will be retried according to configuration
+type RetryableError interface {
+	error
+
+	// false - error is permanent, e.g. badly formatted message,
+	// retry does not make sense
+	Retryable() bool
+}
+
+// Returns true for transient errors
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	var rerr RetryableError
+
+	if errors.As(err, &rerr) {
+		return rerr.Retryable()
+	}
+
+	return true
+}
+
+// Wraps error of the producer as non-retryable
+func PermanentError(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err}
+}
+
+type permanentError struct {
+	err error
+}
+
+func (pe *permanentError) Error() string {
+	return pe.err.Error()
+}
+
+func (pe *permanentError) Unwrap() error {
+	return pe.err
+}
+
+func (pe *permanentError) Retryable() bool {
+	return false
+}
+
+type retryPolicy struct {
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	jitter     float64
+}
+
+func newRetryPolicy(conf ProducerConfiguration) retryPolicy {
+	rp := retryPolicy{
+		attempts:   conf.RETRY_ATTEMPTS,
+		backoff:    time.Duration(conf.RETRY_BACKOFF_MS) * time.Millisecond,
+		maxBackoff: time.Duration(conf.RETRY_MAX_BACKOFF_MS) * time.Millisecond,
+		jitter:     conf.RETRY_JITTER,
+	}
+
+	if rp.attempts < 1 {
+		rp.attempts = 1
+	}
+
+	if rp.backoff <= 0 {
+		rp.backoff = 100 * time.Millisecond
+	}
+
+	if rp.maxBackoff < rp.backoff {
+		rp.maxBackoff = rp.backoff
+	}
+
+	if rp.jitter < 0 {
+		rp.jitter = 0
+	}
+
+	if rp.jitter > 1 {
+		rp.jitter = 1
+	}
+
+	return rp
+}
+
+// Returns delay before retry number 'retry' (starting from 1):
+// exponential backoff limited by maxBackoff with random jitter
+func (rp retryPolicy) delay(retry int) time.Duration {
+	d := rp.backoff
+
+	for i := 1; i < retry; i++ {
+		d *= 2
+		if d >= rp.maxBackoff {
+			d = rp.maxBackoff
+			break
+		}
+	}
+
+	if rp.jitter > 0 {
+		d -= time.Duration(rand.Float64() * rp.jitter * float64(d))
+	}
+
+	return d
+}
+
+// Runs f till success, non-retryable error or exhausting of attempts.
+// cancelled == true - waiting before retry was interrupted via stop channel
+func (rp retryPolicy) run(f func() error, stop <-chan struct{}) (err error, cancelled bool) {
+	for attempt := 1; ; attempt++ {
+		err = f()
+
+		if err == nil {
+			return nil, false
+		}
+
+		if attempt >= rp.attempts {
+			return err, false
+		}
+
+		if !IsRetryable(err) {
+			return err, false
+		}
+
+		timer := time.NewTimer(rp.delay(attempt))
+
+		select {
+		case <-stop:
+			timer.Stop()
+			return err, true
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package syslogsidecar
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func Test_RetryDelay(t *testing.T) {
+	rp := newRetryPolicy(ProducerConfiguration{RETRY_ATTEMPTS: 5, RETRY_BACKOFF_MS: 10, RETRY_MAX_BACKOFF_MS: 30})
+
+	expected := []time.Duration{10, 20, 30, 30}
+
+	for i, exp := range expected {
+		if d := rp.delay(i + 1); d != exp*time.Millisecond {
+			t.Errorf("retry %d expected delay %v actual %v", i+1, exp*time.Millisecond, d)
+		}
+	}
+
+	rp.jitter = 0.5
+
+	for i := 1; i < 5; i++ {
+		if d := rp.delay(i); (d > 30*time.Millisecond) || (d < 5*time.Millisecond) {
+			t.Errorf("retry %d wrong delay with jitter %v", i, d)
+		}
+	}
+}
+
+func Test_RetryRun(t *testing.T) {
+	rp := newRetryPolicy(ProducerConfiguration{RETRY_ATTEMPTS: 3, RETRY_BACKOFF_MS: 1})
+	stop := make(chan struct{})
+
+	calls := 0
+	err, _ := rp.run(func() error { calls++; return fmt.Errorf("transient") }, stop)
+
+	if (err == nil) || (calls != 3) {
+		t.Errorf("expected 3 attempts, actual %d", calls)
+	}
+
+	calls = 0
+	err, _ = rp.run(func() error { calls++; return PermanentError(fmt.Errorf("permanent")) }, stop)
+
+	if IsRetryable(err) || (calls != 1) {
+		t.Errorf("permanent error should not be retried, attempts %d", calls)
+	}
+
+	calls = 0
+	err, _ = rp.run(func() error {
+		calls++
+		if calls < 2 {
+			return fmt.Errorf("transient")
+		}
+		return nil
+	}, stop)
+
+	if (err != nil) || (calls != 2) {
+		t.Errorf("expected success on second attempt, actual %d %v", calls, err)
+	}
+
+	close(stop)
+
+	rp = newRetryPolicy(ProducerConfiguration{RETRY_ATTEMPTS: 3, RETRY_BACKOFF_MS: 10000})
+
+	_, cancelled := rp.run(func() error { return fmt.Errorf("transient") }, stop)
+
+	if !cancelled {
+		t.Errorf("retry should be cancelled")
+	}
+}
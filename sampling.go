@@ -0,0 +1,200 @@
+package syslogsidecar
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"regexp"
+	"strconv"
+
+	"github.com/g41797/sputnik"
+)
+
+// Name of sampling processor and its configuration (sampling.json)
+const SamplingName = "sampling"
+
+// Configuration of sampling processor is stored in sampling.json
+type SamplingConfiguration struct {
+	// Message is sampled according to the first matched rule,
+	// messages which do not match any rule are kept
+	RULES []SamplingRule
+}
+
+// Rule of sampling
+type SamplingRule struct {
+	// Name of the rule used as label of metric syslogsidecar_sampled_out_total
+	NAME string
+
+	// Selects messages by facility and severity, syntax is the same as in syslogconf.json,
+	// e.g. "debug", "local0.info". Empty - all messages
+	SELECTOR string
+
+	// Conditions on parts of the message: name of the part - regular expression,
+	// e.g. {"app_name": "^(nginx|envoy)$"}. Rule is matched if all conditions are matched
+	PARTS map[string]string
+
+	// Part of kept messages [0.0:1.0], e.g. 0.01 - 1%
+	RATE float64
+
+	// Deterministic sampling: decision is based on hash of values of the parts,
+	// e.g. ["hostname", "message"] - all repeats of the message are kept or dropped together.
+	// Empty - random sampling
+	HASH_PARTS []string
+}
+
+// Extra part of kept message with rate of the rule, used for re-weighting of counts
+const SampleRatePart = "sample_rate"
+
+// Resolution of deterministic sampling
+const samplingScale = 1000000
+
+type samplingCondition struct {
+	part string
+	re   *regexp.Regexp
+}
+
+type samplingRule struct {
+	name       string
+	selector   *msgSelector
+	conditions []samplingCondition
+	rate       float64
+	rateText   string
+	hashParts  []string
+}
+
+type sampler struct {
+	conf  SamplingConfiguration
+	rules []*samplingRule
+}
+
+func newSampler() Processor {
+	return new(sampler)
+}
+
+func init() {
+	RegisterProcessorFactory(SamplingName, newSampler)
+}
+
+func (sm *sampler) Init(cf sputnik.ConfFactory) error {
+	if err := cf(SamplingName, &sm.conf); err != nil {
+		return err
+	}
+
+	if len(sm.conf.RULES) == 0 {
+		return fmt.Errorf("empty list of sampling rules")
+	}
+
+	for i, rconf := range sm.conf.RULES {
+		rule, err := newSamplingRule(rconf)
+		if err != nil {
+			return fmt.Errorf("sampling rule %d: %v", i, err)
+		}
+
+		if len(rule.name) == 0 {
+			rule.name = fmt.Sprintf("rule%d", i)
+		}
+
+		sm.rules = append(sm.rules, rule)
+	}
+
+	return nil
+}
+
+func newSamplingRule(rconf SamplingRule) (*samplingRule, error) {
+	if (rconf.RATE < 0) || (rconf.RATE > 1) {
+		return nil, fmt.Errorf("RATE should be in range [0.0:1.0]")
+	}
+
+	rule := &samplingRule{
+		name:      rconf.NAME,
+		rate:      rconf.RATE,
+		rateText:  strconv.FormatFloat(rconf.RATE, 'g', -1, 64),
+		hashParts: rconf.HASH_PARTS,
+	}
+
+	if len(rconf.SELECTOR) > 0 {
+		selector, err := newMsgSelector(rconf.SELECTOR)
+		if err != nil {
+			return nil, err
+		}
+		rule.selector = selector
+	}
+
+	for _, part := range sortedKeys(rconf.PARTS) {
+		re, err := regexp.Compile(rconf.PARTS[part])
+		if err != nil {
+			return nil, fmt.Errorf("condition of part %s: %v", part, err)
+		}
+		rule.conditions = append(rule.conditions, samplingCondition{part: part, re: re})
+	}
+
+	return rule, nil
+}
+
+func (sm *sampler) Process(msg sputnik.Msg) []sputnik.Msg {
+	var parts map[string]string
+
+	for _, rule := range sm.rules {
+		if !rule.selector.match(msg) {
+			continue
+		}
+
+		if (parts == nil) && (len(rule.conditions)+len(rule.hashParts) > 0) {
+			unpacked, err := UnpackToMap(msg)
+			if err != nil {
+				return []sputnik.Msg{msg}
+			}
+			parts = unpacked
+		}
+
+		if !rule.matchParts(parts) {
+			continue
+		}
+
+		if !rule.keep(parts) {
+			mSampledOut.inc(rule.name)
+			Put(msg)
+			return nil
+		}
+
+		if parts == nil {
+			SetPart(msg, SampleRatePart, rule.rateText)
+			return []sputnik.Msg{msg}
+		}
+
+		parts[SampleRatePart] = rule.rateText
+		Pack(msg, parts)
+
+		return []sputnik.Msg{msg}
+	}
+
+	return []sputnik.Msg{msg}
+}
+
+func (rule *samplingRule) matchParts(parts map[string]string) bool {
+	for _, cond := range rule.conditions {
+		val, exists := parts[cond.part]
+		if !exists || !cond.re.MatchString(val) {
+			return false
+		}
+	}
+	return true
+}
+
+func (rule *samplingRule) keep(parts map[string]string) bool {
+	if rule.rate >= 1 {
+		return true
+	}
+
+	if len(rule.hashParts) == 0 {
+		return rand.Float64() < rule.rate
+	}
+
+	h := fnv.New64a()
+	for _, part := range rule.hashParts {
+		h.Write([]byte(parts[part]))
+		h.Write([]byte{0})
+	}
+
+	return float64(h.Sum64()%samplingScale) < rule.rate*samplingScale
+}
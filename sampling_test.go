@@ -0,0 +1,95 @@
+package syslogsidecar
+
+import (
+	"strconv"
+	"testing"
+
+	"github.com/g41797/sputnik"
+)
+
+// Packs RFC5424 message of the application with the severity and the text
+func appMsg(appName string, severity int, message string) sputnik.Msg {
+	parts := makeRFC5424Msg()
+	parts["priority"] = strconv.Itoa(8 + severity)
+	parts[severityKey] = strconv.Itoa(severity)
+	parts["app_name"] = appName
+	parts["message"] = message
+
+	msg := Get()
+	Pack(msg, parts)
+	return msg
+}
+
+func Test_Sampling(t *testing.T) {
+	conf := SamplingConfiguration{
+		RULES: []SamplingRule{
+			{NAME: "noisy-debug", SELECTOR: "debug", PARTS: map[string]string{"app_name": "^noisy"}, RATE: 0.01},
+			{NAME: "noisy-info", SELECTOR: "info", PARTS: map[string]string{"app_name": "^noisy"}, RATE: 0.1,
+				HASH_PARTS: []string{"hostname", "message"}},
+		},
+	}
+
+	prc := newSampler()
+	if err := prc.Init(testConfFactory(SamplingName, conf)); err != nil {
+		t.Fatalf("Init error %v", err)
+	}
+
+	kept := func(appName string, severity int, count int, unique bool) (int, []sputnik.Msg) {
+		var msgs []sputnik.Msg
+		for i := 0; i < count; i++ {
+			message := "message"
+			if unique {
+				message += strconv.Itoa(i)
+			}
+			msgs = append(msgs, prc.Process(appMsg(appName, severity, message))...)
+		}
+		return len(msgs), msgs
+	}
+
+	n, msgs := kept("noisy-app", 7, 1000, false)
+	if n > 50 {
+		t.Errorf("debug: expected about 10 messages actual %d", n)
+	}
+	for _, msg := range msgs {
+		checkPart(t, msg, SampleRatePart, "0.01", true)
+		Put(msg)
+	}
+
+	n, msgs = kept("noisy-app", 6, 1000, true)
+	if (n < 50) || (n > 150) {
+		t.Errorf("info: expected about 100 messages actual %d", n)
+	}
+	for _, msg := range msgs {
+		checkPart(t, msg, SampleRatePart, "0.1", true)
+		Put(msg)
+	}
+
+	// Deterministic sampling - all or nothing for the same message
+	n, msgs = kept("noisy-app", 6, 100, false)
+	if (n != 0) && (n != 100) {
+		t.Errorf("info: expected 0 or 100 messages actual %d", n)
+	}
+	for _, msg := range msgs {
+		Put(msg)
+	}
+
+	for _, tc := range []struct {
+		app      string
+		severity int
+	}{{"noisy-app", 4}, {"quiet-app", 7}} {
+		n, msgs = kept(tc.app, tc.severity, 100, true)
+		if n != 100 {
+			t.Errorf("%s severity %d: messages should be kept, actual %d", tc.app, tc.severity, n)
+		}
+		for _, msg := range msgs {
+			checkPart(t, msg, SampleRatePart, "", false)
+			Put(msg)
+		}
+	}
+
+	if err := newSampler().Init(testConfFactory(SamplingName, SamplingConfiguration{
+		RULES: []SamplingRule{{RATE: 2}},
+	})); err == nil {
+		t.Errorf("wrong rate should fail")
+	}
+}
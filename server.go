@@ -1,11 +1,15 @@
 package syslogsidecar
 
 import (
+	"crypto/tls"
+	"fmt"
+	"strings"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/g41797/go-syslog"
 	"github.com/g41797/go-syslog/format"
-	"github.com/g41797/kissngoqueue"
 	"github.com/g41797/sputnik"
 )
 
@@ -30,51 +34,307 @@ type SyslogConfiguration struct {
 	// 7  - all logs will be processed
 	SEVERITYLEVEL int
 
-	// IPv4 address of TCP listener.
+	// Addresses of TCP listeners - comma separated list.
 	// For empty string - don't use TCP
-	// e.g "0.0.0.0:5141" - listen on all adapters, port 5141
+	// e.g "0.0.0.0:5141" - listen on all IPv4 adapters, port 5141
 	// "127.0.0.1:5141" - listen on loopback "adapter"
+	// "[::]:5141" - listen on all IPv6 (and, for dual-stack host, IPv4) adapters
+	// "10.0.0.5:5141,127.0.0.1:5141" - listen on VLAN address and loopback
 	ADDRTCP string
 
-	// IPv4 address of UDP receiver.
+	// Addresses of UDP receivers - comma separated list.
 	// For empty string - don't use UDP
 	// Usually "0.0.0.0:5141" - receive from all adapters, port 5141
 	// "127.0.0.1:5141" - receive from loopback "adapter"
+	// "[::1]:5141" - receive from IPv6 loopback
 	ADDRUDP string
 
-	// Unix domain socket name - actually file path.
+	// Unix domain socket names (actually file paths) - comma separated list.
 	// For empty string - don't use UDS
 	// Regarding limitations see https://man7.org/linux/man-pages/man7/unix.7.html
+	// "/dev/log" - replacement of the syslog daemon of the host
 	UDSPATH string
 
-	// TLS section: Listening on non empty ADDRTCPTLS will start only
+	// Type of Unix domain sockets: "dgram" (default, SOCK_DGRAM) or "stream" (SOCK_STREAM)
+	UDS_TYPE string
+
+	// Permissions of Unix domain sockets - octal, e.g. "0666". Empty - according to umask
+	UDS_MODE string
+
+	// Owner and group of Unix domain sockets - names or numeric ids. Empty - not changed
+	UDS_OWNER string
+	UDS_GROUP string
+
+	// TLS section: Listening on non empty ADDRTCPTLS (comma separated list) will start only
 	// for valid tls configuration (created using last 3 parameters)
 	ADDRTCPTLS       string
 	CLIENT_CERT_PATH string
 	CLIENT_KEY_PATH  string
 	ROOT_CA_PATH     string
+
+	// Limits of the queue of received messages: number of messages
+	// (0 - 100000, -1 - without limit) and total length of the messages
+	// in bytes (0 - without limit)
+	QUEUE_MAXMSGS  int
+	QUEUE_MAXBYTES int
+
+	// Policy for the full queue:
+	//	"block"            - wait for free space, for TCP - backpressure to the sender (default)
+	//	"drop-newest"      - discard received message
+	//	"drop-oldest"      - discard the oldest message in the queue
+	//	"drop-by-severity" - discard the oldest message with the lowest severity (debug, info, ...),
+	//	                     received message is discarded if all queued messages are more important
+	//	"spill"            - save received message in disk spool QUEUE_SPILL_PATH
+	QUEUE_OVERFLOW string
+
+	// Folder of disk spool for "spill" policy and max number of spilled messages (0 - unlimited)
+	QUEUE_SPILL_PATH    string
+	QUEUE_SPILL_MAXMSGS int
+
+	// Address of HTTP listener for metrics in Prometheus format (/metrics),
+	// health checks (/healthz, /readyz) and statistics of connections (/connections).
+	// For empty string - don't use HTTP
+	// e.g "0.0.0.0:9514"
+	ADDRHTTP string
+
+	// Used part of the limits of the queue [0.0:1.0], which fails readiness
+	// (default 0.9)
+	READY_QUEUE_RATIO float64
+
+	// Names of processors (see RegisterProcessorFactory) in order of processing
+	PROCESSORS []string
+
+	// Number of goroutines running processors.
+	// 0 - processors run in the goroutine of the receiver
+	PROCESSOR_WORKERS int
+
+	// Settings of timestamps per listener: time zone of RFC3164 timestamps
+	// and replacing of timestamps of senders with wrong clock
+	TIMESTAMPS []TimestampConfiguration
+
+	// Format of timestamps of messages:
+	//	"rfc3339nano" (default) - RFC3339 with fractional seconds (if present), e.g. "2003-10-11T22:14:15.003Z"
+	//	"rfc3339"               - RFC3339 without fractional seconds, e.g. "2003-10-11T22:14:15Z"
+	//	"unixms"                - milliseconds since Unix epoch, e.g. "1065910455003"
+	//	"unixns"                - nanoseconds since Unix epoch
+	//	"original"              - text of the timestamp in received message
+	TIMESTAMP_FORMAT string
+
+	// Convert timestamps to UTC (not used for "original")
+	TIMESTAMP_UTC bool
+
+	// Number of UDP sockets with SO_REUSEPORT option for every address of ADDRUDP:
+	//	0  - 8 sockets (default)
+	//	-1 - one socket per CPU
+	//	1  - single socket without SO_REUSEPORT
+	// For OS without support of SO_REUSEPORT - always single socket
+	UDP_SOCKETS int
+
+	// Size of receive buffer (SO_RCVBUF) of every UDP socket in bytes (default 65536).
+	// Kernel limits the size by net.core.rmem_max
+	UDP_RCVBUF int
+
+	// Listeners behind load balancers with PROXY protocol (v1 and v2):
+	// transports ("tcp", "tls") or names of listeners (e.g. "tcp/0.0.0.0:5141")
+	PROXY_PROTOCOL []string
+
+	// Trusted upstreams of PROXY protocol - CIDRs or IP addresses of load balancers,
+	// e.g. ["10.0.0.0/8", "192.168.1.10"].
+	// Connections from trusted upstreams should start with PROXY header,
+	// address of the client from the header is used as the source of messages.
+	// Connections from other addresses are processed without PROXY header
+	PROXY_TRUSTED []string
+
+	// Limits of TCP and TLS connections: total number of connections of all listeners
+	// and number of connections from the same IP address (for PROXY protocol - address
+	// of the load balancer). Connections above the limits are closed. 0 - without limit
+	TCP_MAX_CONNECTIONS        int
+	TCP_MAX_CONNECTIONS_PER_IP int
+
+	// TCP or TLS connection without received data during TCP_IDLE_TIMEOUT_MS milliseconds
+	// is closed. 0 - without timeout
+	TCP_IDLE_TIMEOUT_MS int
+
+	// Max size of received message in bytes. Longer message is truncated,
+	// MESSAGE_TRUNCATION_MARKER (default "...[truncated]") is appended to the truncated part.
+	// 0 - 65536 for TCP and TLS, UDP messages are not truncated
+	MAX_MESSAGE_SIZE          int
+	MESSAGE_TRUNCATION_MARKER string
+
+	// Access control lists of listeners: allowed and denied sources (CIDRs or IP addresses)
+	// of UDP packets and TCP/TLS connections. Sources are checked before parsing.
+	// For PROXY protocol the address of the client from the header is checked
+	ACCESS []AccessConfiguration
+
+	// Rejected sources are logged not often than once per ACCESS_LOG_INTERVAL_MS milliseconds.
+	// 0 - rejected sources are not logged
+	ACCESS_LOG_INTERVAL_MS int
+}
+
+// Listener: go-syslog server or own receiver
+type syslogd interface {
+	Boot() error
+	Kill() error
+	// Waits until goroutines of the listener are finished
+	Wait()
+}
+
+type syslogs []syslogd
+
+// Listener reporting own state for liveness check
+type stateReporter interface {
+	// Returns false and the reason for listener which does not receive messages
+	state() (bool, string)
+}
+
+// Bind and serve state of stream and datagram listeners
+type listenerState struct {
+	bound   atomic.Bool
+	started atomic.Int32 // receive (accept) loops started by Boot
+	loops   atomic.Int32 // running receive loops
+}
+
+func (ls *listenerState) state() (bool, string) {
+	if !ls.bound.Load() {
+		return false, "not bound"
+	}
+
+	started := ls.started.Load()
+
+	if started == 0 {
+		return false, "not started"
+	}
+
+	if ls.loops.Load() < started {
+		return false, "stopped"
+	}
+
+	return true, "running"
+}
+
+// Should be called before start of receive loop
+func (ls *listenerState) loopStarted() {
+	ls.started.Add(1)
+	ls.loops.Add(1)
 }
 
-type syslogs []*syslog.Server
+func (ls *listenerState) loopFinished() {
+	ls.loops.Add(-1)
+}
+
+type boundListener struct {
+	name string
+	ls   syslogd
+}
 
 type server struct {
 	config SyslogConfiguration
 	bc     atomic.Pointer[sputnik.BlockCommunicator]
 	logs   syslogs
-	q      *kissngoqueue.Queue[format.LogParts]
+	q      *logQueue
+	http   *httpServer
+	pipe   *pipeline
+
+	// Finish of processLogParts
+	processing sync.WaitGroup
+
+	// UDP receivers, also included in logs
+	datagrams []*datagramServer
+
+	// TCP and TLS receivers, also included in logs
+	streams []*streamServer
+	limits  *connLimits
+	rejects *rejectLog
+
+	// Bound listeners
+	bound   []boundListener
+	running atomic.Bool
+}
+
+// Handler of the listener: adds name of the listener
+// to processing of received message
+type listenerHandler struct {
+	srv  *server
+	name string
+}
+
+func (lh *listenerHandler) Handle(logParts format.LogParts, msgLen int64, err error) {
+	setHostnameOfClient(logParts)
+	lh.srv.handle(lh.name, logParts, msgLen, err)
+}
+
+// Returns name of the listener e.g. "udp/127.0.0.1:5141"
+func listenerName(transport string, addr string) string {
+	return transport + "/" + addr
+}
+
+// Returns rank of settings of the listener for the listener with transport and address:
+// 3 - name of the listener (e.g. "udp/0.0.0.0:5141"), 2 - transport ("udp"),
+// 1 - all listeners (""), 0 - settings of another listener
+func listenerRank(listener string, transport string, addr string) int {
+	switch listener {
+	case listenerName(transport, addr):
+		return 3
+	case transport:
+		return 2
+	case "":
+		return 1
+	}
+	return 0
+}
+
+// Returns true if the list contains transport (e.g. "tcp")
+// or name of the listener (e.g. "tcp/127.0.0.1:5141")
+func listenerSelected(list []string, transport string, addr string) bool {
+	name := listenerName(transport, addr)
+
+	for _, listener := range list {
+		if (listener == transport) || (listener == name) {
+			return true
+		}
+	}
+
+	return false
 }
 
 func newServer(conf SyslogConfiguration) *server {
 	srv := new(server)
 	srv.config = conf
 	srv.bc = atomic.Pointer[sputnik.BlockCommunicator]{}
-	srv.q = kissngoqueue.NewQueue[format.LogParts]()
+	maxMsgs := conf.QUEUE_MAXMSGS
+	if maxMsgs == 0 {
+		maxMsgs = defaultQueueMaxMsgs
+	}
+	srv.q = newLogQueue(maxMsgs, conf.QUEUE_MAXBYTES, conf.QUEUE_OVERFLOW)
 	srv.logs = make(syslogs, 0)
+	srv.pipe = newPipeline(srv.send)
+	srv.pipe.tsFormat, srv.pipe.tsUTC = conf.TIMESTAMP_FORMAT, conf.TIMESTAMP_UTC
+	srv.rejects = newRejectLog(time.Duration(conf.ACCESS_LOG_INTERVAL_MS) * time.Millisecond)
+	if (conf.TCP_MAX_CONNECTIONS > 0) || (conf.TCP_MAX_CONNECTIONS_PER_IP > 0) {
+		srv.limits = newConnLimits(conf.TCP_MAX_CONNECTIONS, conf.TCP_MAX_CONNECTIONS_PER_IP)
+	}
 	return srv
 }
 
+// Creates processors according to configuration
+func (s *server) initPipeline(cf sputnik.ConfFactory) error {
+	return s.pipe.init(s.config.PROCESSORS, cf, s.config.PROCESSOR_WORKERS)
+}
+
 func (s *server) initServer() error {
 
+	if err := s.initQueue(); err != nil {
+		return err
+	}
+
+	if err := checkTimestampFormat(s.config.TIMESTAMP_FORMAT); err != nil {
+		return err
+	}
+
+	if err := s.initHTTP(); err != nil {
+		return err
+	}
+
 	if err := s.newsyslogdTCP(); err != nil {
 		return err
 	}
@@ -87,55 +347,200 @@ func (s *server) initServer() error {
 		return err
 	}
 
-	ls, err := s.newsyslogdUDP()
+	if err := s.newsyslogdUDP(); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (s *server) initQueue() error {
+
+	if err := checkOverflowPolicy(s.config.QUEUE_OVERFLOW); err != nil {
+		return err
+	}
+
+	if s.config.QUEUE_OVERFLOW != OverflowSpill {
+		return nil
+	}
+
+	sp, err := openSpool(s.config.QUEUE_SPILL_PATH, ReceiverName, s.config.QUEUE_SPILL_MAXMSGS)
 	if err != nil {
 		return err
 	}
 
-	if ls != nil {
+	s.q.setSpill(sp)
 
-		s.logs = append(s.logs, ls)
+	return nil
+}
 
-		if ls.IsUDPReusable() {
-			for i := 1; i < 8; i++ {
-				ls, _ := s.newsyslogdUDP()
-				s.logs = append(s.logs, ls)
-			}
-		}
+func (s *server) initHTTP() error {
+	if len(s.config.ADDRHTTP) == 0 {
+		return nil
 	}
 
-	go s.processLogParts()
+	hs, err := newHTTPServer(s.config.ADDRHTTP)
+	if err != nil {
+		return err
+	}
+
+	hs.handle("/metrics", registry)
+	hs.handle("/healthz", health.handler(false))
+	hs.handle("/readyz", health.handler(true))
+	hs.handle("/connections", connectionsHandler(func() []*streamServer { return s.streams }))
+
+	s.http = hs
+
+	if s.config.READY_QUEUE_RATIO <= 0 {
+		s.config.READY_QUEUE_RATIO = 0.9
+	}
+
+	health.add(ReceiverName, true, s.checkListeners)
+	health.add(ReceiverName, false, s.checkPipeline)
+
+	mQueueDepth.collect(func(report func(val float64, lvalues ...string)) {
+		msgs, _, spilled := s.q.depth()
+		report(float64(msgs), "memory")
+		report(float64(spilled), "spill")
+	})
+
+	mQueueBytes.collect(func(report func(val float64, lvalues ...string)) {
+		_, bytes, _ := s.q.depth()
+		report(float64(bytes))
+	})
+
+	mConnections.collect(func(report func(val float64, lvalues ...string)) {
+		for _, ss := range s.streams {
+			report(float64(ss.connections()), ss.name)
+		}
+	})
+
+	mUDPKernelDrops.collect(func(report func(val float64, lvalues ...string)) {
+		if len(s.datagrams) == 0 {
+			return
+		}
+
+		drops := udpKernelDrops()
+
+		for _, ds := range s.datagrams {
+			ds.reportDrops(drops, report)
+		}
+	})
+
+	mQueueDropped.collect(func(report func(val float64, lvalues ...string)) {
+		report(float64(s.q.drops.newest.Load()), OverflowDropNewest)
+		report(float64(s.q.drops.oldest.Load()), OverflowDropOldest)
+		report(float64(s.q.drops.bySeverity.Load()), OverflowBySeverity)
+		report(float64(s.q.drops.spill.Load()), OverflowSpill)
+	})
 
 	return nil
 }
 
-func (s *server) newsyslogd() *syslog.Server {
-	result := syslog.NewServer()
-	result.SetFormat(syslog.Automatic)
-	result.SetHandler(s)
-	return result
+// Liveness: every bound listener is running
+func (s *server) checkListeners() []checkResult {
+	running := s.running.Load()
+
+	var results []checkResult
+
+	for _, bl := range s.bound {
+		res := checkResult{Name: "listener " + bl.name, Ok: running, Status: "running"}
+		if !running {
+			res.Status = "stopped"
+		}
+
+		ls := bl.ls
+		if ul, ok := ls.(*udsListener); ok {
+			ls = ul.syslogd
+		}
+
+		// Listeners of go-syslog do not report own state
+		if reporter, ok := ls.(stateReporter); ok && running {
+			res.Ok, res.Status = reporter.state()
+		}
+
+		results = append(results, res)
+	}
+
+	return results
 }
 
-func (s *server) newsyslogdTCP() error {
+// Readiness: received messages are forwarded to the producer,
+// the queue is not saturated
+func (s *server) checkPipeline() []checkResult {
+	bc := s.bc.Load()
+	forwarding := (bc != nil) && (*bc != nil)
 
-	if len(s.config.ADDRTCP) == 0 {
-		return nil
+	pipeline := checkResult{Name: "receiver", Ok: forwarding, Status: "forwarding"}
+	if !forwarding {
+		pipeline.Status = "producer is not attached"
 	}
 
-	ls := s.newsyslogd()
+	sat := s.q.saturation()
 
-	if err := ls.ListenTCP(s.config.ADDRTCP); err != nil {
-		return err
+	queue := checkResult{
+		Name:   "queue",
+		Ok:     sat < s.config.READY_QUEUE_RATIO,
+		Status: fmt.Sprintf("saturation %.2f", sat),
+	}
+
+	return []checkResult{pipeline, queue}
+}
+
+// Saves bound listener
+func (s *server) listening(transport string, addr string, ls syslogd) {
+	name := listenerName(transport, addr)
+
+	for _, bl := range s.bound {
+		if bl.name == name {
+			return
+		}
 	}
 
-	s.logs = append(s.logs, ls)
+	s.bound = append(s.bound, boundListener{name: name, ls: ls})
+}
+
+func (s *server) newsyslogd(transport string, addr string) (*syslog.Server, error) {
+	form, err := formatOfListener(s.config.TIMESTAMPS, transport, addr, s.config.TIMESTAMP_FORMAT == TimestampOriginal)
+	if err != nil {
+		return nil, err
+	}
+
+	result := syslog.NewServer()
+	result.SetFormat(form)
+	result.SetHandler(&listenerHandler{s, listenerName(transport, addr)})
+	return result, nil
+}
+
+// Returns addresses of comma separated list, e.g. "127.0.0.1:5141,[::1]:5141"
+func addressesOf(list string) []string {
+	var result []string
+
+	for _, addr := range strings.Split(list, ",") {
+		if addr = strings.TrimSpace(addr); len(addr) > 0 {
+			result = append(result, addr)
+		}
+	}
+
+	return result
+}
+
+func (s *server) newsyslogdTCP() error {
+
+	for _, addr := range addressesOf(s.config.ADDRTCP) {
+		if err := s.newsyslogdStream("tcp", addr, nil); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
 func (s *server) newsyslogdTCPTLS() error {
 
-	if len(s.config.ADDRTCPTLS) == 0 {
+	addrs := addressesOf(s.config.ADDRTCPTLS)
+
+	if len(addrs) == 0 {
 		return nil
 	}
 
@@ -149,56 +554,210 @@ func (s *server) newsyslogdTCPTLS() error {
 		return nil
 	}
 
-	ls := s.newsyslogd()
+	for _, addr := range addrs {
+		if err = s.newsyslogdStream("tls", addr, t); err != nil {
+			return err
+		}
+	}
 
-	if err = ls.ListenTCPTLS(s.config.ADDRTCPTLS, t); err != nil {
+	return nil
+}
+
+// Creates TCP or TLS listener
+func (s *server) newsyslogdStream(transport string, addr string, t *tls.Config) error {
+	name := listenerName(transport, addr)
+
+	form, err := formatOfListener(s.config.TIMESTAMPS, transport, addr, s.config.TIMESTAMP_FORMAT == TimestampOriginal)
+	if err != nil {
+		return err
+	}
+
+	access, err := newAccessList(s.config.ACCESS, transport, addr, s.rejects)
+	if err != nil {
 		return err
 	}
 
-	s.logs = append(s.logs, ls)
+	ss := newStreamServer(name, form, &listenerHandler{s, name})
+	ss.setTLS(t)
+	ss.setAccess(access)
+	ss.setLimits(s.limits, time.Duration(s.config.TCP_IDLE_TIMEOUT_MS)*time.Millisecond)
+	ss.setMaxMessageSize(s.config.MAX_MESSAGE_SIZE, s.config.MESSAGE_TRUNCATION_MARKER)
+
+	if listenerSelected(s.config.PROXY_PROTOCOL, transport, addr) {
+		proxy, err := newProxyProtocol(s.config.PROXY_TRUSTED)
+		if err != nil {
+			return fmt.Errorf("PROXY protocol of %s: %v", name, err)
+		}
+		ss.setProxy(proxy)
+	}
+
+	if err = ss.Listen("tcp", addr); err != nil {
+		return err
+	}
+
+	s.listening(transport, addr, ss)
+
+	s.logs = append(s.logs, ss)
+	s.streams = append(s.streams, ss)
 
 	return nil
 }
 
 func (s *server) newsyslogdUDS() error {
 
-	if len(s.config.UDSPATH) == 0 {
+	paths := addressesOf(s.config.UDSPATH)
+
+	if len(paths) == 0 {
 		return nil
 	}
 
-	ls := s.newsyslogd()
+	if udsType := s.config.UDS_TYPE; (len(udsType) > 0) && (udsType != UDSDatagram) && (udsType != UDSStream) {
+		return fmt.Errorf("wrong UDS_TYPE %q", udsType)
+	}
 
-	if err := ls.ListenUnixgram(s.config.UDSPATH); err != nil {
+	access, err := newUDSAccess(s.config.UDS_MODE, s.config.UDS_OWNER, s.config.UDS_GROUP)
+	if err != nil {
 		return err
 	}
 
-	s.logs = append(s.logs, ls)
+	for _, path := range paths {
+		if err = removeStaleSocket(path); err != nil {
+			return err
+		}
+
+		ls, err := listenUDS(path, access, func(socket string) (syslogd, error) {
+			if s.config.UDS_TYPE == UDSStream {
+				return s.newsyslogdUnixStream(path, socket)
+			}
+			return s.newsyslogdUnixgram(path, socket)
+		})
+
+		if err != nil {
+			return err
+		}
+
+		// Socket is removed by Kill
+		ul := &udsListener{syslogd: ls, path: path}
+
+		s.listening("uds", path, ul)
+
+		s.logs = append(s.logs, ul)
+	}
 
 	return nil
 }
 
-func (s *server) newsyslogdUDP() (*syslog.Server, error) {
+// Listener of the path, socket is created by the listener
+func (s *server) newsyslogdUnixgram(path string, socket string) (syslogd, error) {
+	ls, err := s.newsyslogd("uds", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = ls.ListenUnixgram(socket); err != nil {
+		return nil, err
+	}
+
+	return ls, nil
+}
+
+func (s *server) newsyslogdUnixStream(path string, socket string) (syslogd, error) {
+	name := listenerName("uds", path)
 
-	if len(s.config.ADDRUDP) == 0 {
-		return nil, nil
+	form, err := formatOfListener(s.config.TIMESTAMPS, "uds", path, s.config.TIMESTAMP_FORMAT == TimestampOriginal)
+	if err != nil {
+		return nil, err
 	}
 
-	ls := s.newsyslogd()
+	ss := newStreamServer(name, form, &listenerHandler{s, name})
+	ss.setSplit(scanUDSRecords, udsStreamEnds)
+	ss.setMaxMessageSize(s.config.MAX_MESSAGE_SIZE, s.config.MESSAGE_TRUNCATION_MARKER)
 
-	if err := ls.ListenUDP(s.config.ADDRUDP); err != nil {
+	if err = ss.Listen("unix", socket); err != nil {
 		return nil, err
 	}
 
-	return ls, nil
+	s.streams = append(s.streams, ss)
+
+	return ss, nil
+}
+
+func (s *server) newsyslogdUDP() error {
+
+	sockets := udpSocketsOf(s.config.UDP_SOCKETS)
+
+	for _, addr := range addressesOf(s.config.ADDRUDP) {
+		name := listenerName("udp", addr)
+
+		form, err := formatOfListener(s.config.TIMESTAMPS, "udp", addr, s.config.TIMESTAMP_FORMAT == TimestampOriginal)
+		if err != nil {
+			return err
+		}
+
+		access, err := newAccessList(s.config.ACCESS, "udp", addr, s.rejects)
+		if err != nil {
+			return err
+		}
+
+		ds := newDatagramServer(name, form, &listenerHandler{s, name})
+		ds.setAccess(access)
+		ds.setMaxMessageSize(s.config.MAX_MESSAGE_SIZE, s.config.MESSAGE_TRUNCATION_MARKER)
+
+		if err = ds.ListenUDP(addr, sockets, s.config.UDP_RCVBUF); err != nil {
+			return err
+		}
+
+		s.listening("udp", addr, ds)
+
+		s.logs = append(s.logs, ds)
+		s.datagrams = append(s.datagrams, ds)
+	}
+
+	return nil
 }
 
 func (s *server) start() error {
-	return s.logs.Boot()
+	if err := s.logs.Boot(); err != nil {
+		return err
+	}
+
+	s.running.Store(true)
+
+	s.rejects.start()
+
+	s.pipe.start()
+
+	s.processing.Add(1)
+	go s.processLogParts()
+
+	s.http.start()
+
+	return nil
 }
 
+// Stops listeners, sends queued messages and flushes processors
 func (s *server) stop() error {
-	s.q.CancelMT()
-	return s.logs.Kill()
+	s.running.Store(false)
+	err := s.logs.Kill()
+	s.logs.Wait()
+	s.rejects.stop()
+	s.q.close()
+	s.processing.Wait()
+	s.q.cancel()
+	s.pipe.stop()
+	s.q.spill.close()
+
+	if s.http != nil {
+		s.http.stop()
+		health.remove(ReceiverName)
+		mQueueDepth.reset()
+		mQueueBytes.reset()
+		mQueueDropped.reset()
+		mUDPKernelDrops.reset()
+		mConnections.reset()
+	}
+
+	return err
 }
 
 func (s *server) setupHandling(bc sputnik.BlockCommunicator) {
@@ -207,28 +766,66 @@ func (s *server) setupHandling(bc sputnik.BlockCommunicator) {
 
 // Process received and parsed syslog messages - called by go-syslog
 func (s *server) Handle(logParts format.LogParts, msgLen int64, err error) {
+	s.handle("", logParts, msgLen, err)
+}
+
+func (s *server) handle(listener string, logParts format.LogParts, msgLen int64, err error) {
 	if s.bc.Load() == nil {
 		return
 	}
 
+	form := formatOf(logParts)
+
+	mReceived.inc(listener, form)
+	mMessageSize.observe(float64(msgLen), listener, form)
+
 	if (err == nil) && (!s.forHandle(logParts)) {
+		mFiltered.inc(listener, form)
 		return
 	}
 
-	s.q.PutMT(logParts)
+	logParts[listenerKey] = listener
+
+	formatTimestamp(logParts, s.config.TIMESTAMP_FORMAT, s.config.TIMESTAMP_UTC)
+
+	s.q.put(logParts, int(msgLen))
 }
 
 func (s *server) processLogParts() {
+	defer s.processing.Done()
+
 	for {
-		lp, ok := s.q.Get()
+		item, ok := s.q.get()
 		if !ok {
 			break
 		}
-		(*s.bc.Load()).Send(toMsg(lp))
+
+		msg := item.msg
+		if msg == nil {
+			msg = toMsg(item.logParts)
+			if msg == nil {
+				continue
+			}
+			setSource(msg, item.logParts)
+		}
+
+		s.pipe.push(msg)
 	}
 	return
 }
 
+// Sends processed message to the producer
+func (s *server) send(msg sputnik.Msg) {
+	bc := s.bc.Load()
+
+	if (bc == nil) || (*bc == nil) {
+		Put(msg)
+		return
+	}
+
+	(*bc).Send(msg)
+}
+
 func (s *server) forHandle(logParts format.LogParts) bool {
 	if s.config.SEVERITYLEVEL == -1 {
 		return false
@@ -279,3 +876,9 @@ func (logs syslogs) Kill() error {
 	}
 	return nil
 }
+
+func (logs syslogs) Wait() {
+	for _, l := range logs {
+		l.Wait()
+	}
+}
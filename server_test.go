@@ -1,10 +1,12 @@
 package syslogsidecar
 
 import (
+	"reflect"
 	"strconv"
 	"testing"
 
 	syslogclient "github.com/RackSec/srslog"
+	"github.com/g41797/go-syslog/format"
 	"github.com/g41797/kissngoqueue"
 	"github.com/g41797/sputnik"
 )
@@ -195,3 +197,60 @@ func Test_Exchange(t *testing.T) {
 		test.exchange()
 	}
 }
+
+func Test_ListenAddresses(t *testing.T) {
+	if addrs := addressesOf(" 127.0.0.1:5151, [::1]:5151,,"); !reflect.DeepEqual(addrs, []string{"127.0.0.1:5151", "[::1]:5151"}) {
+		t.Errorf("wrong addresses %v", addrs)
+	}
+
+	conf := defaultServerConfiguration()
+	conf.ADDRTCP = "127.0.0.1:5151,127.0.0.1:5152"
+	conf.ADDRUDP = "127.0.0.1:5151,127.0.0.1:5152"
+
+	srv := newServer(conf)
+	if err := srv.initServer(); err != nil {
+		t.Fatalf("Init error %v", err)
+	}
+	defer srv.stop()
+
+	for _, name := range []string{"tcp/127.0.0.1:5151", "tcp/127.0.0.1:5152", "udp/127.0.0.1:5151", "udp/127.0.0.1:5152"} {
+		found := false
+		for _, bl := range srv.bound {
+			found = found || (bl.name == name)
+		}
+		if !found {
+			t.Errorf("listener %s is not bound: %v", name, srv.bound)
+		}
+	}
+}
+
+func Test_HostnameOfClient(t *testing.T) {
+	for _, tc := range []struct {
+		hostname any
+		client   string
+		expected any
+	}{
+		{"", "[::1]:40000", "::1"},
+		// Set by go-syslog
+		{"[::1]:40000", "[::1]:40000", "::1"},
+		{"[fe80", "[fe80::1]:40000", "fe80::1"},
+		{"10.0.0.1", "10.0.0.1:40000", "10.0.0.1"},
+		{"", "10.0.0.1:40000", "10.0.0.1"},
+		{"host", "10.0.0.1:40000", "host"},
+		// Real hostname in brackets
+		{"[router]", "[fe80::1]:40000", "[router]"},
+		{"[fe80", "10.0.0.1:40000", "[fe80"},
+		{nil, "10.0.0.1:40000", nil},
+	} {
+		logParts := format.LogParts{"client": tc.client}
+		if tc.hostname != nil {
+			logParts["hostname"] = tc.hostname
+		}
+
+		setHostnameOfClient(logParts)
+
+		if actual := logParts["hostname"]; actual != tc.expected {
+			t.Errorf("%v %s: expected %v actual %v", tc.hostname, tc.client, tc.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package syslogsidecar
+
+import (
+	"net"
+	"strings"
+
+	"github.com/g41797/go-syslog/format"
+	"github.com/g41797/sputnik"
+)
+
+// Name of the message key with source of received message
+const sourceKey = "source"
+
+// Name of the log part with name of the listener, added by receiver
+const listenerKey = "listener"
+
+type msgSource struct {
+	client   string
+	listener string
+}
+
+// Returns IP address of the sender (empty for unix socket)
+// and name of the listener (e.g. "udp/127.0.0.1:5141") of received message.
+// Source is saved with the message in the spill and spool
+func Source(msg sputnik.Msg) (client string, listener string) {
+	src, _ := msg[sourceKey].(msgSource)
+	return src.client, src.listener
+}
+
+// Saves source of the message from log parts of go-syslog
+func setSource(msg sputnik.Msg, logParts format.LogParts) {
+	client, _ := logParts["client"].(string)
+	listener, _ := logParts[listenerKey].(string)
+
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		client = host
+	}
+
+	msg[sourceKey] = msgSource{client: client, listener: listener}
+}
+
+// Sets hostname of the message without hostname to the address of the sender.
+// go-syslog does it only for own formats and cuts IPv6 address
+// at the first colon (e.g. "[fe80" for "[fe80::1]:5141")
+func setHostnameOfClient(logParts format.LogParts) {
+	hostname, ok := logParts["hostname"].(string)
+	if !ok {
+		return
+	}
+
+	client, _ := logParts["client"].(string)
+
+	if (len(hostname) > 0) && !isClientHostname(hostname, client) {
+		return
+	}
+
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		client = host
+	}
+
+	logParts["hostname"] = client
+}
+
+// Returns true for hostname set by go-syslog from the address of the client:
+// the whole address or its part before the first colon
+func isClientHostname(hostname string, client string) bool {
+	if hostname == client {
+		return true
+	}
+
+	i := strings.Index(client, ":")
+
+	return (i > 1) && (hostname == client[:i])
+}
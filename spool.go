@@ -0,0 +1,365 @@
+package syslogsidecar
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/g41797/sputnik"
+)
+
+// Disk FIFO for messages which cannot be produced now.
+// Every message is saved as JSON line with syslog parts of the message
+// (see UnpackToMap) and the source of the message (see Source).
+// Not consumed messages are saved between restarts of the process.
+type spool struct {
+	lock    sync.Mutex
+	fPath   string
+	maxMsgs int
+	file    *os.File
+	size    int64
+	rdOff   int64
+	pending int64
+	count   int
+}
+
+// Opens (creates if doesn't exist) spool file 'name'.spool within folder.
+// maxMsgs <= 0 - size of the spool is unlimited
+func openSpool(folder string, name string, maxMsgs int) (*spool, error) {
+	if len(folder) == 0 {
+		return nil, fmt.Errorf("empty spool folder")
+	}
+
+	if err := os.MkdirAll(folder, 0755); err != nil {
+		return nil, err
+	}
+
+	sp := new(spool)
+	sp.fPath = filepath.Join(folder, name+".spool")
+	sp.maxMsgs = maxMsgs
+
+	file, err := os.OpenFile(sp.fPath, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	sp.file = file
+
+	if err = sp.recover(); err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	return sp, nil
+}
+
+// Counts messages saved by previous run.
+// Partial last line (e.g. after crash during write) is removed
+func (sp *spool) recover() error {
+	info, err := sp.file.Stat()
+	if err != nil {
+		return err
+	}
+
+	sp.size = info.Size()
+
+	end, err := lastLineEnd(sp.file, sp.size)
+	if err != nil {
+		return err
+	}
+
+	if end < sp.size {
+		log.Printf("syslogsidecar: spool %s: removed partial last line (%d bytes)", sp.fPath, sp.size-end)
+
+		if err = sp.file.Truncate(end); err != nil {
+			return err
+		}
+		sp.size = end
+	}
+
+	scanner := bufio.NewScanner(io.NewSectionReader(sp.file, 0, sp.size))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		sp.count++
+	}
+
+	return scanner.Err()
+}
+
+// Returns size of the file content till the last LF (inclusive), 0 - without LF
+func lastLineEnd(file io.ReaderAt, size int64) (int64, error) {
+	buf := make([]byte, 4096)
+
+	for end := size; end > 0; {
+		start := end - int64(len(buf))
+		if start < 0 {
+			start = 0
+		}
+
+		chunk := buf[:end-start]
+		if _, err := file.ReadAt(chunk, start); err != nil {
+			return 0, err
+		}
+
+		if i := bytes.LastIndexByte(chunk, '\n'); i >= 0 {
+			return start + int64(i) + 1, nil
+		}
+
+		end = start
+	}
+
+	return 0, nil
+}
+
+// Saves message in the spool.
+// Message may be returned to the pool after successful put
+func (sp *spool) put(msg sputnik.Msg) error {
+	if sp == nil {
+		return fmt.Errorf("nil spool")
+	}
+
+	line, err := spooledLine(msg)
+	if err != nil {
+		return err
+	}
+
+	sp.lock.Lock()
+	defer sp.lock.Unlock()
+
+	return sp.write(line)
+}
+
+// Saves message in the spool only if the spool is not empty, returns true for saved message.
+// Check and saving are atomic - used for keeping order of the messages
+func (sp *spool) putIfNotEmpty(msg sputnik.Msg) (bool, error) {
+	if sp.len() == 0 {
+		return false, nil
+	}
+
+	line, err := spooledLine(msg)
+	if err != nil {
+		return false, err
+	}
+
+	sp.lock.Lock()
+	defer sp.lock.Unlock()
+
+	if sp.count == 0 {
+		return false, nil
+	}
+
+	if err = sp.write(line); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Returns JSON line with parts and source of the message
+func spooledLine(msg sputnik.Msg) ([]byte, error) {
+	parts, err := UnpackToMap(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	if client, listener := Source(msg); len(client)+len(listener) > 0 {
+		parts[spooledClientKey] = client
+		parts[spooledListenerKey] = listener
+	}
+
+	line, err := json.Marshal(parts)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(line, '\n'), nil
+}
+
+// Appends the line to the file, called under lock
+func (sp *spool) write(line []byte) error {
+	if sp.file == nil {
+		return fmt.Errorf("spool %s closed", sp.fPath)
+	}
+
+	if (sp.maxMsgs > 0) && (sp.count >= sp.maxMsgs) {
+		return fmt.Errorf("spool %s is full", sp.fPath)
+	}
+
+	n, err := sp.file.WriteAt(line, sp.size)
+	if err != nil {
+		return err
+	}
+
+	sp.size += int64(n)
+	sp.count++
+
+	return nil
+}
+
+// Returns the oldest message without removing it from the spool.
+// Use commit for removing
+func (sp *spool) peek() (sputnik.Msg, bool) {
+	if sp == nil {
+		return nil, false
+	}
+
+	sp.lock.Lock()
+	defer sp.lock.Unlock()
+
+	for (sp.file != nil) && (sp.count > 0) {
+		reader := bufio.NewReader(io.NewSectionReader(sp.file, sp.rdOff, sp.size-sp.rdOff))
+
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return nil, false
+		}
+
+		sp.pending = int64(len(line))
+
+		msg, err := toSpooledMsg(line)
+		if err == nil {
+			return msg, true
+		}
+
+		// Skip corrupted line
+		sp.remove()
+	}
+
+	return nil, false
+}
+
+// Removes message returned by peek
+func (sp *spool) commit() {
+	if sp == nil {
+		return
+	}
+
+	sp.lock.Lock()
+	defer sp.lock.Unlock()
+
+	sp.remove()
+}
+
+func (sp *spool) remove() {
+	if sp.pending == 0 {
+		return
+	}
+
+	sp.rdOff += sp.pending
+	sp.pending = 0
+	sp.count--
+
+	if sp.rdOff < sp.size {
+		return
+	}
+
+	// All messages were consumed
+	sp.file.Truncate(0)
+	sp.size = 0
+	sp.rdOff = 0
+	sp.count = 0
+}
+
+// Returns number of messages in the spool
+func (sp *spool) len() int {
+	if sp == nil {
+		return 0
+	}
+
+	sp.lock.Lock()
+	defer sp.lock.Unlock()
+
+	return sp.count
+}
+
+// Returns max number of messages, 0 - unlimited
+func (sp *spool) capacity() int {
+	if sp == nil {
+		return 0
+	}
+	return sp.maxMsgs
+}
+
+// Removes consumed messages from the file and closes it
+func (sp *spool) close() error {
+	if sp == nil {
+		return nil
+	}
+
+	sp.lock.Lock()
+	defer sp.lock.Unlock()
+
+	if sp.file == nil {
+		return nil
+	}
+
+	err := sp.compact()
+
+	if cerr := sp.file.Close(); err == nil {
+		err = cerr
+	}
+
+	sp.file = nil
+
+	return err
+}
+
+func (sp *spool) compact() error {
+	if sp.rdOff == 0 {
+		return nil
+	}
+
+	rest := make([]byte, sp.size-sp.rdOff)
+
+	if _, err := sp.file.ReadAt(rest, sp.rdOff); err != nil {
+		return err
+	}
+
+	if _, err := sp.file.WriteAt(rest, 0); err != nil {
+		return err
+	}
+
+	sp.size = int64(len(rest))
+	sp.rdOff = 0
+
+	return sp.file.Truncate(sp.size)
+}
+
+// Keys of the source of the message within saved line
+const (
+	spooledClientKey   = "@source_client"
+	spooledListenerKey = "@source_listener"
+)
+
+func toSpooledMsg(line []byte) (sputnik.Msg, error) {
+	parts := make(map[string]string)
+
+	if err := json.Unmarshal(line, &parts); err != nil {
+		return nil, err
+	}
+
+	client, hasClient := parts[spooledClientKey]
+	listener, hasListener := parts[spooledListenerKey]
+	delete(parts, spooledClientKey)
+	delete(parts, spooledListenerKey)
+
+	msg := Get()
+
+	if err := Pack(msg, parts); err != nil {
+		Put(msg)
+		return nil, err
+	}
+
+	if hasClient || hasListener {
+		msg[sourceKey] = msgSource{client: client, listener: listener}
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,196 @@
+package syslogsidecar
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_SpoolPutPeekCommit(t *testing.T) {
+	folder := t.TempDir()
+
+	sp, err := openSpool(folder, "test", 2)
+	if err != nil {
+		t.Fatalf("open spool error %v", err)
+	}
+
+	in := []map[string]string{makeRFC5424Msg(), makeRFC3164Msg()}
+
+	for _, parts := range in {
+		msg := Get()
+		if err = Pack(msg, parts); err != nil {
+			t.Fatalf("Pack error %v", err)
+		}
+		if err = sp.put(msg); err != nil {
+			t.Fatalf("put error %v", err)
+		}
+		Put(msg)
+	}
+
+	msg := Get()
+	Pack(msg, makeRFC5424Msg())
+	if err = sp.put(msg); err == nil {
+		t.Errorf("put to full spool should fail")
+	}
+	Put(msg)
+
+	// Messages should survive restart
+	sp.close()
+
+	sp, err = openSpool(folder, "test", 2)
+	if err != nil {
+		t.Fatalf("reopen spool error %v", err)
+	}
+	defer sp.close()
+
+	if sp.len() != len(in) {
+		t.Fatalf("expected %d messages actual %d", len(in), sp.len())
+	}
+
+	for _, parts := range in {
+		msg, ok := sp.peek()
+		if !ok {
+			t.Fatalf("peek failed")
+		}
+
+		out, err := UnpackToMap(msg)
+		if err != nil {
+			t.Fatalf("unpack error %v", err)
+		}
+
+		if !reflect.DeepEqual(parts, out) {
+			t.Errorf("Expected %v Actual %v", parts, out)
+		}
+
+		sp.commit()
+	}
+
+	if _, ok := sp.peek(); ok || (sp.len() != 0) {
+		t.Errorf("spool should be empty")
+	}
+}
+
+func Test_SpoolSource(t *testing.T) {
+	sp, err := openSpool(t.TempDir(), "test", 0)
+	if err != nil {
+		t.Fatalf("open spool error %v", err)
+	}
+	defer sp.close()
+
+	msg := Get()
+	Pack(msg, makeRFC5424Msg())
+	msg[sourceKey] = msgSource{client: "10.0.0.1", listener: "udp/0.0.0.0:5141"}
+	sp.put(msg)
+	Put(msg)
+
+	msg = Get()
+	Pack(msg, makeRFC3164Msg())
+	sp.put(msg)
+	Put(msg)
+
+	for _, expected := range []msgSource{{"10.0.0.1", "udp/0.0.0.0:5141"}, {}} {
+		msg, ok := sp.peek()
+		if !ok {
+			t.Fatalf("peek failed")
+		}
+
+		if client, listener := Source(msg); client != expected.client || listener != expected.listener {
+			t.Errorf("expected source %v actual %s %s", expected, client, listener)
+		}
+
+		if parts, _ := UnpackToMap(msg); len(parts[spooledClientKey]) > 0 {
+			t.Errorf("source saved as part %v", parts)
+		}
+
+		Put(msg)
+		sp.commit()
+	}
+}
+
+func Test_SpoolPutIfNotEmpty(t *testing.T) {
+	sp, err := openSpool(t.TempDir(), "test", 0)
+	if err != nil {
+		t.Fatalf("open spool error %v", err)
+	}
+	defer sp.close()
+
+	msg := Get()
+	defer Put(msg)
+	Pack(msg, makeRFC5424Msg())
+
+	if spooled, err := sp.putIfNotEmpty(msg); spooled || err != nil {
+		t.Errorf("message should not be saved to empty spool: %v %v", spooled, err)
+	}
+
+	sp.put(msg)
+
+	if spooled, err := sp.putIfNotEmpty(msg); !spooled || err != nil || sp.len() != 2 {
+		t.Errorf("message should be saved to non-empty spool: %v %v", spooled, err)
+	}
+
+	var nilSpool *spool
+	if spooled, err := nilSpool.putIfNotEmpty(msg); spooled || err != nil {
+		t.Errorf("nil spool: %v %v", spooled, err)
+	}
+}
+
+// Partial last line after crash is removed on open
+func Test_SpoolPartialLine(t *testing.T) {
+	folder := t.TempDir()
+
+	sp, err := openSpool(folder, "test", 0)
+	if err != nil {
+		t.Fatalf("open spool error %v", err)
+	}
+
+	put := func(parts map[string]string) {
+		msg := Get()
+		Pack(msg, parts)
+		if err := sp.put(msg); err != nil {
+			t.Fatalf("put error %v", err)
+		}
+		Put(msg)
+	}
+
+	first, second := makeRFC5424Msg(), makeRFC3164Msg()
+
+	put(first)
+	sp.close()
+
+	file, err := os.OpenFile(sp.fPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		t.Fatalf("open file error %v", err)
+	}
+	file.WriteString(`{"message":"` + strings.Repeat("x", 5000))
+	file.Close()
+
+	if sp, err = openSpool(folder, "test", 0); err != nil {
+		t.Fatalf("reopen spool error %v", err)
+	}
+	defer sp.close()
+
+	if sp.len() != 1 {
+		t.Fatalf("expected 1 message actual %d", sp.len())
+	}
+
+	put(second)
+
+	for _, parts := range []map[string]string{first, second} {
+		msg, ok := sp.peek()
+		if !ok {
+			t.Fatalf("peek failed")
+		}
+
+		out, err := UnpackToMap(msg)
+		if err != nil {
+			t.Fatalf("unpack error %v", err)
+		}
+
+		if !reflect.DeepEqual(parts, out) {
+			t.Errorf("Expected %v Actual %v", parts, out)
+		}
+
+		sp.commit()
+	}
+}
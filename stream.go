@@ -0,0 +1,383 @@
+package syslogsidecar
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/g41797/go-syslog"
+	"github.com/g41797/go-syslog/format"
+)
+
+// TCP (TLS) and stream Unix domain socket receiver: every accepted connection has own goroutine,
+// received messages are split and parsed by format of go-syslog.
+// Optional PROXY protocol header is processed before TLS handshake
+type streamServer struct {
+	name      string
+	format    format.Format
+	handler   syslog.Handler
+	tlsConfig *tls.Config
+	proxy     *proxyProtocol
+	listener  net.Listener
+
+	split bufio.SplitFunc // nil - split function of the format
+	ends  string
+
+	access      *accessList
+	limits      *connLimits
+	idleTimeout time.Duration
+	maxSize     int
+	marker      string
+
+	lock  sync.Mutex
+	conns map[net.Conn]*connStats
+
+	listenerState
+
+	done chan struct{}
+	wait sync.WaitGroup
+}
+
+func newStreamServer(name string, form format.Format, handler syslog.Handler) *streamServer {
+	return &streamServer{
+		name:    name,
+		format:  form,
+		handler: handler,
+		maxSize: defaultMaxMessageSize,
+		marker:  defaultTruncationMarker,
+		conns:   make(map[net.Conn]*connStats),
+		done:    make(chan struct{}),
+	}
+}
+
+// Uses TLS for accepted connections
+func (ss *streamServer) setTLS(config *tls.Config) {
+	ss.tlsConfig = config
+}
+
+// Expects PROXY protocol header from trusted upstreams
+func (ss *streamServer) setProxy(proxy *proxyProtocol) {
+	ss.proxy = proxy
+}
+
+// Splits received data by split instead of split function of the format,
+// ends - bytes of the end of the message for skipping the rest of truncated message
+func (ss *streamServer) setSplit(split bufio.SplitFunc, ends string) {
+	ss.split = split
+	ss.ends = ends
+}
+
+// Checks sources of connections (nil - all sources are allowed).
+// For PROXY protocol - address of the client from the header
+func (ss *streamServer) setAccess(access *accessList) {
+	ss.access = access
+}
+
+// Limits number of connections (nil - without limits)
+// and closes connection without data during idleTimeout (0 - without timeout)
+func (ss *streamServer) setLimits(limits *connLimits, idleTimeout time.Duration) {
+	ss.limits = limits
+	ss.idleTimeout = idleTimeout
+}
+
+// Truncates messages longer than max bytes (0 - default)
+func (ss *streamServer) setMaxMessageSize(max int, marker string) {
+	if max > 0 {
+		ss.maxSize = max
+	}
+	if len(marker) > 0 {
+		ss.marker = marker
+	}
+}
+
+func (ss *streamServer) Listen(network string, addr string) error {
+	listener, err := net.Listen(network, addr)
+	if err != nil {
+		return err
+	}
+
+	ss.listener = listener
+	ss.bound.Store(true)
+
+	return nil
+}
+
+func (ss *streamServer) Boot() error {
+	if ss.format == nil {
+		return fmt.Errorf("please set a valid format")
+	}
+
+	if ss.handler == nil {
+		return fmt.Errorf("please set a valid handler")
+	}
+
+	ss.wait.Add(1)
+	ss.loopStarted()
+	go ss.accept()
+
+	return nil
+}
+
+// Closes the listener and all accepted connections
+func (ss *streamServer) Kill() error {
+	close(ss.done)
+	ss.bound.Store(false)
+
+	err := ss.listener.Close()
+
+	ss.lock.Lock()
+	for conn := range ss.conns {
+		conn.Close()
+	}
+	ss.lock.Unlock()
+
+	return err
+}
+
+// Waits until all connections are closed
+func (ss *streamServer) Wait() {
+	ss.wait.Wait()
+}
+
+func (ss *streamServer) stopped() bool {
+	select {
+	case <-ss.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// Returns number of open connections
+func (ss *streamServer) connections() int {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	return len(ss.conns)
+}
+
+// Returns statistics of open connections
+func (ss *streamServer) reports() []connReport {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	result := make([]connReport, 0, len(ss.conns))
+
+	for _, stats := range ss.conns {
+		result = append(result, stats.report())
+	}
+
+	return result
+}
+
+func (ss *streamServer) accept() {
+	defer ss.wait.Done()
+	defer ss.loopFinished()
+
+	for {
+		conn, err := ss.listener.Accept()
+		if err != nil {
+			if ss.stopped() {
+				return
+			}
+			time.Sleep(10 * time.Millisecond)
+			continue
+		}
+
+		proxied := (ss.proxy != nil) && ss.proxy.trusted(conn.RemoteAddr())
+
+		if !proxied && !ss.access.permits(conn.RemoteAddr()) {
+			conn.Close()
+			continue
+		}
+
+		var ip string
+		if addr, ok := ipOf(conn.RemoteAddr()); ok {
+			ip = addr.String()
+		}
+
+		if reason, ok := ss.limits.acquire(ip); !ok {
+			mConnectionsRejected.inc(ss.name, reason)
+			conn.Close()
+			continue
+		}
+
+		stats := &connStats{listener: ss.name, since: time.Now()}
+		if remoteAddr := conn.RemoteAddr(); remoteAddr != nil {
+			stats.client = remoteAddr.String()
+		}
+
+		if !ss.track(conn, stats) {
+			ss.limits.release(ip)
+			conn.Close()
+			return
+		}
+
+		ss.wait.Add(1)
+		go ss.serve(conn, ip, proxied, stats)
+	}
+}
+
+// Saves accepted connection for closing by Kill
+func (ss *streamServer) track(conn net.Conn, stats *connStats) bool {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	if ss.stopped() {
+		return false
+	}
+
+	ss.conns[conn] = stats
+
+	return true
+}
+
+func (ss *streamServer) untrack(conn net.Conn) {
+	ss.lock.Lock()
+	defer ss.lock.Unlock()
+
+	delete(ss.conns, conn)
+}
+
+// Sets deadline of the next read according to idle timeout
+func (ss *streamServer) extendDeadline(conn net.Conn) {
+	if ss.idleTimeout > 0 {
+		conn.SetReadDeadline(time.Now().Add(ss.idleTimeout))
+	}
+}
+
+func (ss *streamServer) serve(conn net.Conn, ip string, proxied bool, stats *connStats) {
+	defer ss.wait.Done()
+	defer ss.limits.release(ip)
+	defer ss.untrack(conn)
+	defer conn.Close()
+
+	raw := conn
+	client := stats.client
+
+	var r io.Reader = conn
+
+	if proxied {
+		br := bufio.NewReader(conn)
+
+		conn.SetReadDeadline(time.Now().Add(proxyHeaderTimeout))
+		source, err := readProxyHeader(br)
+		conn.SetReadDeadline(time.Time{})
+
+		if err != nil {
+			mProxyHeaders.inc(ss.name, proxyInvalid)
+			return
+		}
+
+		if len(source) > 0 {
+			addrPort, err := netip.ParseAddrPort(source)
+			if err != nil {
+				mProxyHeaders.inc(ss.name, proxyInvalid)
+				return
+			}
+
+			if !ss.access.permitsIP(addrPort.Addr().Unmap()) {
+				return
+			}
+
+			client = source
+			mProxyHeaders.inc(ss.name, proxyForwarded)
+		} else {
+			// LOCAL or UNKNOWN - the upstream itself is the client
+			mProxyHeaders.inc(ss.name, proxyLocal)
+
+			if !ss.access.permits(raw.RemoteAddr()) {
+				return
+			}
+		}
+
+		r = br
+		conn = &bufferedConn{Conn: conn, r: br}
+	}
+
+	ss.lock.Lock()
+	stats.client = client
+	ss.lock.Unlock()
+
+	tlsPeer := ""
+
+	if ss.tlsConfig != nil {
+		tlsConn := tls.Server(conn, ss.tlsConfig)
+
+		ss.extendDeadline(raw)
+		if err := tlsConn.Handshake(); err != nil {
+			return
+		}
+
+		// The same as default of go-syslog: CN of the certificate of the peer
+		state := tlsConn.ConnectionState()
+		if len(state.PeerCertificates) == 0 {
+			return
+		}
+		tlsPeer = state.PeerCertificates[0].Subject.CommonName
+
+		r = tlsConn
+	}
+
+	formSplit := ss.format.GetSplitFunc()
+	if ss.split != nil {
+		formSplit = ss.split
+	}
+
+	split := newLimitedSplit(formSplit, ss.maxSize, ss.marker, func() {
+		stats.truncated.Add(1)
+		mTruncated.inc(ss.name)
+	})
+	if len(ss.ends) > 0 {
+		split.ends = ss.ends
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Split(split.scan)
+	scanner.Buffer(make([]byte, 0, minInt(4096, ss.maxSize)), ss.maxSize)
+
+	for !ss.stopped() {
+		ss.extendDeadline(raw)
+
+		if !scanner.Scan() {
+			break
+		}
+
+		line := scanner.Bytes()
+
+		stats.messages.Add(1)
+		stats.bytes.Add(uint64(len(line)))
+
+		if err := parseLine(ss.format, ss.handler, line, client, tlsPeer); err != nil {
+			stats.parseErrors.Add(1)
+		}
+	}
+
+	if err := scanner.Err(); errors.Is(err, os.ErrDeadlineExceeded) && !ss.stopped() {
+		mConnectionsIdleClosed.inc(ss.name)
+	}
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// Connection with data already read to the buffer (e.g. during processing of PROXY header)
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (bc *bufferedConn) Read(b []byte) (int, error) {
+	return bc.r.Read(b)
+}
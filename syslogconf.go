@@ -21,7 +21,43 @@ import (
 // Sidecar transfers targets to producer with solely processing -
 // trim spaces on both sides of the string.
 // Target may be any non-empty valid for JSON format string.
+// Targets replaced by processor (see SetTargets) are used instead of syslogconf.json.
+// Target may be qualified by the name of registered producer, e.g. "nats:app-critical".
+// Named producer receives only own targets without qualification ("app-critical"),
+// default producer - only unqualified targets.
 func Targets(msg sputnik.Msg) ([]string, error) {
+	all, err := targets(msg)
+	if err != nil {
+		return nil, err
+	}
+
+	name, exists := msg[producerKey].(string)
+	if !exists {
+		return all, nil
+	}
+
+	var result []string
+
+	for _, target := range all {
+		tname, trgt := splitTarget(target)
+		if tname == name {
+			result = append(result, trgt)
+			continue
+		}
+		if (len(tname) == 0) && unqualifiedReceiver(name) {
+			result = append(result, trgt)
+		}
+	}
+
+	return result, nil
+}
+
+// Returns qualified targets of the message
+func targets(msg sputnik.Msg) ([]string, error) {
+
+	if replaced, exists := replacedTargets(msg); exists {
+		return replaced, nil
+	}
 
 	bfonce.Do(buildFinders)
 
@@ -68,6 +104,35 @@ func Targets(msg sputnik.Msg) ([]string, error) {
 	return targets, nil
 }
 
+// Returns list of all non-repeating "targets" of the producer with the name
+// (empty name for default producer) existing in syslogconf.json file.
+// Targets are returned without qualification
+func AllTargetsOf(name string) ([]string, error) {
+	all, err := AllTargets()
+	if err != nil {
+		return nil, err
+	}
+
+	var result []string
+
+	trgmap := make(map[string]bool)
+
+	for _, target := range all {
+		tname, trgt := splitTarget(target)
+
+		if (tname != name) && !((len(tname) == 0) && unqualifiedReceiver(name)) {
+			continue
+		}
+
+		if _, exists := trgmap[trgt]; !exists {
+			trgmap[trgt] = true
+			result = append(result, trgt)
+		}
+	}
+
+	return result, nil
+}
+
 // Returns list of all non-repeating "targets" existing in syslogconf.json file
 // and error for absent or wrong syslogconf.json file.
 func AllTargets() ([]string, error) {
@@ -349,6 +414,49 @@ func (tf *targetFinder) severitiesOfFacitity(facility, severity string) (string,
 	return tf.severities_(facility, severity)
 }
 
+// Matches messages by facility and severity.
+// Syntax of the selector is the same as in syslogconf.json,
+// e.g. "local0.err,crit", "auth,authpriv", "warning,notice", "data"
+type msgSelector struct {
+	finder *targetFinder
+}
+
+func newMsgSelector(selector string) (*msgSelector, error) {
+	entry := slfEntry{
+		Selector: strings.ToLower(strings.ReplaceAll(selector, " ", "")),
+		Target:   "match",
+	}
+
+	if len(entry.Selector) == 0 {
+		return nil, fmt.Errorf("empty selector")
+	}
+
+	finder, err := entry.toFinder()
+	if err != nil {
+		return nil, err
+	}
+
+	return &msgSelector{finder: finder}, nil
+}
+
+// nil selector matches all messages
+func (ms *msgSelector) match(msg sputnik.Msg) bool {
+	if ms == nil {
+		return true
+	}
+
+	priority, exists := Part(msg, "priority")
+	if !exists {
+		priority = Formermessage
+	}
+
+	facility, severity := facsev(priority)
+
+	target, _ := ms.finder.gettarget(facility, severity)
+
+	return len(target) > 0
+}
+
 var fis = map[int]string{
 	0:  "kern",
 	1:  "user",
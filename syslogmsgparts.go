@@ -188,6 +188,10 @@ func toString(val any, typ string) string {
 		result = strconv.Itoa(intval)
 		return result
 	case "time.Time":
+		// Already formatted by receiver (see formatTimestamp)
+		if text, ok := val.(string); ok {
+			return text
+		}
 		tval, _ := val.(time.Time)
 		result = tval.Format(time.RFC3339)
 		return result
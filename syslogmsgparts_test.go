@@ -4,10 +4,12 @@ import (
 	"fmt"
 	"reflect"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/g41797/go-syslog/format"
+	"github.com/g41797/sputnik"
 )
 
 func Test_PackUnpackBadlyFormatted(t *testing.T) {
@@ -40,6 +42,52 @@ func Test_PackUnpackBadlyFormatted(t *testing.T) {
 	}
 }
 
+// Message packed again (e.g. pooled message) should contain only new parts
+func Test_RepackMsg(t *testing.T) {
+	msg := map[string]any{}
+
+	if err := Pack(msg, makeRFC5424Msg()); err != nil {
+		t.Fatalf("Pack error %v", err)
+	}
+
+	in := makeRFC3164Msg()
+
+	if err := Pack(msg, in); err != nil {
+		t.Fatalf("Pack error %v", err)
+	}
+
+	out, err := UnpackToMap(msg)
+	if err != nil {
+		t.Fatalf("UnpackToMap error %v", err)
+	}
+
+	if !reflect.DeepEqual(in, out) {
+		t.Errorf("Expected %v Actual %v", in, out)
+	}
+}
+
+// Packed message may fill the buffer of the parts exactly
+func Test_PackFullBuffer(t *testing.T) {
+	for size := 1; size < 300; size++ {
+		in := makeRFC3164Msg()
+		in["content"] = strings.Repeat("x", size)
+
+		msg := map[string]any{}
+		if err := Pack(msg, in); err != nil {
+			t.Fatalf("Pack error %v", err)
+		}
+
+		out, err := UnpackToMap(msg)
+		if err != nil {
+			t.Fatalf("content of %d: UnpackToMap error %v", size, err)
+		}
+
+		if !reflect.DeepEqual(in, out) {
+			t.Errorf("Expected %v Actual %v", in, out)
+		}
+	}
+}
+
 func Test_PackUnpackRFC3164Msg(t *testing.T) {
 	testPackUnpackRFCMsg(makeRFC3164Msg(), rfc3164parts[:], t)
 }
@@ -48,6 +96,38 @@ func Test_PackUnpackRFC5424Msg(t *testing.T) {
 	testPackUnpackRFCMsg(makeRFC5424Msg(), rfc5424parts[:], t)
 }
 
+// Copy of shorter message keeps capacity of the destination,
+// the next pack should not lose parts
+func Test_PackAfterCopy(t *testing.T) {
+	long := makeRFC5424Msg()
+	long["message"] = strings.Repeat("long message ", 100)
+
+	dst := newMessage().(sputnik.Msg)
+	if err := Pack(dst, long); err != nil {
+		t.Fatalf("Pack error %v", err)
+	}
+
+	src := newMessage().(sputnik.Msg)
+	if err := Pack(src, makeRFC3164Msg()); err != nil {
+		t.Fatalf("Pack error %v", err)
+	}
+
+	dst[syslogmessage].(*syslogmsgparts).copyFrom(&src[syslogmessage].(*syslogmsgparts).parts)
+
+	if err := Pack(dst, long); err != nil {
+		t.Fatalf("Pack error %v", err)
+	}
+
+	unpacked, err := UnpackToMap(dst)
+	if err != nil {
+		t.Fatalf("Unpack error %v", err)
+	}
+
+	if !reflect.DeepEqual(long, unpacked) {
+		t.Errorf("Expected %v Actual %v", long, unpacked)
+	}
+}
+
 func testPackUnpackRFCMsg(in map[string]string, descr []partType, t *testing.T) {
 
 	logparts, err := toLogParts(in, descr)
@@ -0,0 +1,277 @@
+package syslogsidecar
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/g41797/go-syslog"
+	"github.com/g41797/go-syslog/format"
+)
+
+// Formats of timestamps of messages
+const (
+	TimestampRFC3339Nano = "rfc3339nano"
+	TimestampRFC3339     = "rfc3339"
+	TimestampUnixMs      = "unixms"
+	TimestampUnixNs      = "unixns"
+	TimestampOriginal    = "original"
+)
+
+func checkTimestampFormat(form string) error {
+	switch form {
+	case "", TimestampRFC3339Nano, TimestampRFC3339, TimestampUnixMs, TimestampUnixNs, TimestampOriginal:
+		return nil
+	}
+	return fmt.Errorf("wrong timestamp format %s", form)
+}
+
+// Name of the log part with text of the timestamp in received message
+const originalTimestampKey = "timestamp_original"
+
+// Replaces timestamp of log parts by the text in required format.
+// Without original text (e.g. for badly formatted message) "original" is
+// replaced by "rfc3339nano"
+func formatTimestamp(logParts format.LogParts, form string, utc bool) {
+	ts, ok := logParts["timestamp"].(time.Time)
+	if !ok {
+		return
+	}
+
+	original, _ := logParts[originalTimestampKey].(string)
+
+	logParts["timestamp"] = formatTime(ts, original, form, utc)
+}
+
+// Returns text of the time in required format.
+// Empty original text for "original" - "rfc3339nano"
+func formatTime(ts time.Time, original string, form string, utc bool) string {
+	if utc {
+		ts = ts.UTC()
+	}
+
+	var text string
+
+	switch form {
+	case TimestampRFC3339:
+		text = ts.Format(time.RFC3339)
+	case TimestampUnixMs:
+		text = strconv.FormatInt(ts.UnixMilli(), 10)
+	case TimestampUnixNs:
+		text = strconv.FormatInt(ts.UnixNano(), 10)
+	case TimestampOriginal:
+		text = original
+	}
+
+	if len(text) == 0 {
+		text = ts.Format(time.RFC3339Nano)
+	}
+
+	return text
+}
+
+// Returns text of the timestamp of RFC3164 or RFC5424 line
+func timestampText(line []byte) string {
+	end := bytes.IndexByte(line, '>')
+	if len(line) == 0 || line[0] != '<' || end < 0 {
+		return ""
+	}
+
+	rest := line[end+1:]
+
+	// RFC5424 version
+	if len(rest) > 2 && rest[0] >= '1' && rest[0] <= '9' && rest[1] == ' ' {
+		rest = rest[2:]
+	}
+
+	// RFC3164 "Mmm dd hh:mm:ss"
+	if len(rest) >= len(time.Stamp) && rest[0] >= 'A' && rest[0] <= 'Z' {
+		return string(rest[:len(time.Stamp)])
+	}
+
+	if space := bytes.IndexByte(rest, ' '); space >= 0 {
+		rest = rest[:space]
+	}
+
+	if string(rest) == "-" {
+		return ""
+	}
+
+	return string(rest)
+}
+
+// Settings of timestamps of messages received by the listener
+type TimestampConfiguration struct {
+	// Listener: transport ("tcp", "udp", "tls", "uds") or name of the listener
+	// (e.g. "udp/0.0.0.0:5141"). Empty - all listeners.
+	// Settings of the name are used before settings of the transport
+	LISTENER string
+
+	// Time zone of RFC3164 timestamps ("Oct 11 22:14:15"), e.g. "Europe/Berlin",
+	// "Local" - time zone of the sidecar. Default "UTC"
+	TIMEZONE string
+
+	// Timestamp which differs from the time of receiving more than
+	// MAX_CLOCK_SKEW_MS milliseconds is replaced by the time of receiving.
+	// 0 - timestamps are not replaced
+	MAX_CLOCK_SKEW_MS int
+}
+
+// Returns settings for the listener, nil - without settings
+func timestampConfOf(confs []TimestampConfiguration, transport string, addr string) *TimestampConfiguration {
+	var result *TimestampConfiguration
+
+	rank := 0
+
+	for i := range confs {
+		if r := listenerRank(confs[i].LISTENER, transport, addr); r > rank {
+			rank = r
+			result = &confs[i]
+		}
+	}
+
+	return result
+}
+
+// Corrects timestamps of messages received by the listener:
+//   - RFC3164 timestamp is interpreted in configured time zone
+//   - year of RFC3164 timestamp is the year nearest to the time of receiving
+//   - timestamp of the sender with wrong clock is replaced by the time of receiving
+type timestampFixer struct {
+	listener string
+	location *time.Location
+	maxSkew  time.Duration
+	now      func() time.Time
+}
+
+func newTimestampFixer(conf *TimestampConfiguration, listener string) (*timestampFixer, error) {
+	tf := &timestampFixer{listener: listener, location: time.UTC, now: time.Now}
+
+	if len(conf.TIMEZONE) > 0 {
+		location, err := time.LoadLocation(conf.TIMEZONE)
+		if err != nil {
+			return nil, fmt.Errorf("wrong TIMEZONE of %s: %v", listener, err)
+		}
+		tf.location = location
+	}
+
+	if conf.MAX_CLOCK_SKEW_MS > 0 {
+		tf.maxSkew = time.Duration(conf.MAX_CLOCK_SKEW_MS) * time.Millisecond
+	}
+
+	return tf, nil
+}
+
+func (tf *timestampFixer) fix(logParts format.LogParts, stamp bool) {
+	ts, ok := logParts["timestamp"].(time.Time)
+	if !ok {
+		return
+	}
+
+	now := tf.now()
+
+	if _, rfc3164 := logParts[rfc3164OnlyKey]; rfc3164 && stamp {
+		ts = nearestYear(ts, now.In(tf.location))
+	}
+
+	if (tf.maxSkew > 0) && (absDuration(ts.Sub(now)) > tf.maxSkew) {
+		ts = now.In(ts.Location()).Truncate(time.Second)
+		mTimestampReplaced.inc(tf.listener)
+	}
+
+	logParts["timestamp"] = ts
+}
+
+// Returns date and time of ts in location of now
+// with the year nearest to now (e.g. Dec 31 received at Jan 1 - previous year)
+func nearestYear(ts time.Time, now time.Time) time.Time {
+	var result time.Time
+
+	for year := now.Year() - 1; year <= now.Year()+1; year++ {
+		candidate := time.Date(year, ts.Month(), ts.Day(),
+			ts.Hour(), ts.Minute(), ts.Second(), ts.Nanosecond(), now.Location())
+
+		if result.IsZero() || (absDuration(candidate.Sub(now)) < absDuration(result.Sub(now))) {
+			result = candidate
+		}
+	}
+
+	return result
+}
+
+func absDuration(d time.Duration) time.Duration {
+	if d < 0 {
+		return -d
+	}
+	return d
+}
+
+// Returns true for RFC3164 line with timestamp without year and time zone ("<34>Oct 11 22:14:15 ...")
+func hasStamp(line []byte) bool {
+	if len(line) == 0 || line[0] != '<' {
+		return false
+	}
+
+	end := bytes.IndexByte(line, '>')
+	if end < 0 || end+1 >= len(line) {
+		return false
+	}
+
+	c := line[end+1]
+
+	return c >= 'A' && c <= 'Z'
+}
+
+// Automatic format of go-syslog with correction of timestamps
+// and saving of original text of timestamps
+type fixingFormat struct {
+	format.Format
+	fixer    *timestampFixer
+	original bool
+}
+
+func (ff *fixingFormat) GetParser(line []byte) format.LogParser {
+	fp := &fixingParser{LogParser: ff.Format.GetParser(line), stamp: hasStamp(line), fixer: ff.fixer}
+	if ff.original {
+		fp.text = timestampText(line)
+	}
+	return fp
+}
+
+type fixingParser struct {
+	format.LogParser
+	stamp bool
+	text  string
+	fixer *timestampFixer
+}
+
+func (fp *fixingParser) Dump() format.LogParts {
+	logParts := fp.LogParser.Dump()
+
+	if fp.fixer != nil {
+		fp.fixer.fix(logParts, fp.stamp)
+	}
+
+	if len(fp.text) > 0 {
+		logParts[originalTimestampKey] = fp.text
+	}
+
+	return logParts
+}
+
+// Returns format of the listener.
+// Year of RFC3164 timestamps is corrected also for listener without settings
+func formatOfListener(confs []TimestampConfiguration, transport string, addr string, original bool) (format.Format, error) {
+	conf := timestampConfOf(confs, transport, addr)
+	if conf == nil {
+		conf = &TimestampConfiguration{}
+	}
+
+	fixer, err := newTimestampFixer(conf, listenerName(transport, addr))
+	if err != nil {
+		return nil, err
+	}
+
+	return &fixingFormat{Format: syslog.Automatic, fixer: fixer, original: original}, nil
+}
@@ -0,0 +1,148 @@
+package syslogsidecar
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_NearestYear(t *testing.T) {
+	for _, tc := range []struct {
+		ts, now, expected string
+	}{
+		{"0000-12-31T23:59:58Z", "2027-01-01T00:00:05Z", "2026-12-31T23:59:58Z"},
+		{"0000-01-01T00:00:03Z", "2026-12-31T23:59:59Z", "2027-01-01T00:00:03Z"},
+		{"0000-06-15T12:00:00Z", "2026-06-15T11:00:00Z", "2026-06-15T12:00:00Z"},
+	} {
+		ts, _ := time.Parse(time.RFC3339, tc.ts)
+		now, _ := time.Parse(time.RFC3339, tc.now)
+
+		if actual := nearestYear(ts, now).Format(time.RFC3339); actual != tc.expected {
+			t.Errorf("%s received %s: expected %s actual %s", tc.ts, tc.now, tc.expected, actual)
+		}
+	}
+}
+
+func Test_TimestampFix(t *testing.T) {
+	confs := []TimestampConfiguration{
+		{TIMEZONE: "UTC"},
+		{LISTENER: "udp", TIMEZONE: "Europe/Berlin", MAX_CLOCK_SKEW_MS: 3600000},
+		{LISTENER: "udp/127.0.0.1:5141", TIMEZONE: "America/New_York"},
+	}
+
+	if conf := timestampConfOf(confs, "udp", "127.0.0.1:5141"); conf.TIMEZONE != "America/New_York" {
+		t.Errorf("settings of the name should be used, actual %s", conf.TIMEZONE)
+	}
+
+	if conf := timestampConfOf(confs, "udp", "0.0.0.0:5141"); conf.TIMEZONE != "Europe/Berlin" {
+		t.Errorf("settings of the transport should be used, actual %s", conf.TIMEZONE)
+	}
+
+	if conf := timestampConfOf(confs, "tcp", "0.0.0.0:5141"); conf.TIMEZONE != "UTC" {
+		t.Errorf("default settings should be used, actual %s", conf.TIMEZONE)
+	}
+
+	if conf := timestampConfOf(nil, "tcp", "0.0.0.0:5141"); conf != nil {
+		t.Errorf("listener without settings")
+	}
+
+	form, err := formatOfListener(confs, "udp", "0.0.0.0:5141", false)
+	if err != nil {
+		t.Fatalf("formatOfListener error %v", err)
+	}
+
+	fixer := form.(*fixingFormat).fixer
+	fixer.now = func() time.Time {
+		now, _ := time.Parse(time.RFC3339, "2027-01-01T00:00:05.7+01:00")
+		return now
+	}
+
+	for _, tc := range []struct {
+		line     string
+		expected string
+	}{
+		// Previous year in Berlin
+		{"<34>Dec 31 23:59:58 host app: text", "2026-12-31T23:59:58+01:00"},
+		// Timestamp with zone is not changed
+		{"<34>2027-01-01T02:00:01+03:00 host app: text", "2027-01-01T02:00:01+03:00"},
+		{"<34>1 2027-01-01T01:00:00.003+02:00 host app - - - text", "2027-01-01T01:00:00.003+02:00"},
+		// Clock skew above 1 hour
+		{"<34>1 2003-10-11T22:14:15Z host app - - - text", "2026-12-31T23:00:05Z"},
+	} {
+		parser := form.GetParser([]byte(tc.line))
+		parser.Parse()
+
+		ts, _ := parser.Dump()["timestamp"].(time.Time)
+
+		if actual := ts.Format(time.RFC3339Nano); actual != tc.expected {
+			t.Errorf("%s: expected %s actual %s", tc.line, tc.expected, actual)
+		}
+	}
+
+	// Year is corrected for listener without settings (UTC)
+	form, _ = formatOfListener(nil, "tcp", "0.0.0.0:5141", false)
+	form.(*fixingFormat).fixer.now = func() time.Time {
+		now, _ := time.Parse(time.RFC3339, "2027-01-01T00:00:05Z")
+		return now
+	}
+
+	parser := form.GetParser([]byte("<34>Dec 31 23:59:58 host app: text"))
+	parser.Parse()
+
+	if ts, _ := parser.Dump()["timestamp"].(time.Time); ts.Format(time.RFC3339) != "2026-12-31T23:59:58Z" {
+		t.Errorf("wrong default year correction %v", ts)
+	}
+
+	if _, err = formatOfListener([]TimestampConfiguration{{TIMEZONE: "Mars/Olympus"}}, "tcp", "0.0.0.0:5141", false); err == nil {
+		t.Errorf("wrong time zone should fail")
+	}
+}
+
+func Test_TimestampFormat(t *testing.T) {
+	line := "<34>1 2003-10-11T22:14:15.003+02:00 host app - - - text"
+
+	form, err := formatOfListener(nil, "udp", "0.0.0.0:5141", true)
+	if err != nil {
+		t.Fatalf("formatOfListener error %v", err)
+	}
+
+	for _, tc := range []struct {
+		form     string
+		utc      bool
+		expected string
+	}{
+		{"", false, "2003-10-11T22:14:15.003+02:00"},
+		{TimestampRFC3339Nano, true, "2003-10-11T20:14:15.003Z"},
+		{TimestampRFC3339, false, "2003-10-11T22:14:15+02:00"},
+		{TimestampUnixMs, false, "1065903255003"},
+		{TimestampUnixNs, false, "1065903255003000000"},
+		{TimestampOriginal, true, "2003-10-11T22:14:15.003+02:00"},
+	} {
+		parser := form.GetParser([]byte(line))
+		parser.Parse()
+		logParts := parser.Dump()
+
+		formatTimestamp(logParts, tc.form, tc.utc)
+
+		if actual := toString(logParts["timestamp"], "time.Time"); actual != tc.expected {
+			t.Errorf("%s: expected %s actual %s", tc.form, tc.expected, actual)
+		}
+	}
+
+	for _, tc := range []struct {
+		line     string
+		expected string
+	}{
+		{"<34>Oct 11 22:14:15 host app: text", "Oct 11 22:14:15"},
+		{"<34>2003-10-11T22:14:15Z host app: text", "2003-10-11T22:14:15Z"},
+		{"<34>1 - host app - - - text", ""},
+		{"no priority", ""},
+	} {
+		if actual := timestampText([]byte(tc.line)); actual != tc.expected {
+			t.Errorf("%s: expected %q actual %q", tc.line, tc.expected, actual)
+		}
+	}
+
+	if err = checkTimestampFormat("unixs"); err == nil {
+		t.Errorf("wrong format should fail")
+	}
+}
@@ -0,0 +1,199 @@
+package syslogsidecar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Types of Unix domain sockets
+const (
+	UDSDatagram = "dgram"
+	UDSStream   = "stream"
+)
+
+// Ends of messages received by stream Unix domain socket:
+// glibc syslog() terminates every message by NUL, other clients - by LF
+const udsStreamEnds = "\n\x00"
+
+// Access settings of Unix domain socket
+type udsAccess struct {
+	mode fs.FileMode
+	uid  int
+	gid  int
+}
+
+// Returns access settings for mode (octal, e.g. "0666"), owner and group
+// (names or numeric ids), empty strings - settings are not changed
+func newUDSAccess(mode string, owner string, group string) (*udsAccess, error) {
+	result := &udsAccess{uid: -1, gid: -1}
+
+	if len(mode) > 0 {
+		perm, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil || perm > 0o777 {
+			return nil, fmt.Errorf("wrong UDS_MODE %q", mode)
+		}
+		result.mode = fs.FileMode(perm)
+	}
+
+	if len(owner) > 0 {
+		uid, err := lookupID(owner, func(name string) (string, error) {
+			u, err := user.Lookup(name)
+			if err != nil {
+				return "", err
+			}
+			return u.Uid, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("wrong UDS_OWNER %q: %v", owner, err)
+		}
+		result.uid = uid
+	}
+
+	if len(group) > 0 {
+		gid, err := lookupID(group, func(name string) (string, error) {
+			g, err := user.LookupGroup(name)
+			if err != nil {
+				return "", err
+			}
+			return g.Gid, nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("wrong UDS_GROUP %q: %v", group, err)
+		}
+		result.gid = gid
+	}
+
+	return result, nil
+}
+
+// Numeric id is used as is, otherwise id is looked up by the name
+func lookupID(name string, lookup func(name string) (string, error)) (int, error) {
+	if id, err := strconv.Atoi(name); err == nil {
+		return id, nil
+	}
+
+	id, err := lookup(name)
+	if err != nil {
+		return -1, err
+	}
+
+	return strconv.Atoi(id)
+}
+
+// Changes mode and ownership of created socket
+func (ua *udsAccess) apply(path string) error {
+	if ua.mode != 0 {
+		if err := os.Chmod(path, ua.mode); err != nil {
+			return err
+		}
+	}
+
+	if (ua.uid >= 0) || (ua.gid >= 0) {
+		if err := os.Chown(path, ua.uid, ua.gid); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Creates the socket in temporary directory near the path (accessible only by the owner),
+// changes its mode and ownership and moves it to the path.
+// Clients cannot connect to the socket before access settings are applied
+func listenUDS(path string, access *udsAccess, listen func(socket string) (syslogd, error)) (syslogd, error) {
+	dir, err := os.MkdirTemp(filepath.Dir(path), ".syslogsidecar-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, filepath.Base(path))
+
+	ls, err := listen(socket)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = access.apply(socket); err == nil {
+		err = os.Rename(socket, path)
+	}
+
+	if err != nil {
+		ls.Kill()
+		return nil, err
+	}
+
+	return ls, nil
+}
+
+// Removes stale socket (e.g. after crash) before listening.
+// Fails if the path is not a socket or the socket is used by another process
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if info.Mode()&fs.ModeSocket == 0 {
+		return fmt.Errorf("%s exists and is not a socket", path)
+	}
+
+	for _, network := range []string{"unixgram", "unix"} {
+		if conn, err := net.DialTimeout(network, path, time.Second); err == nil {
+			conn.Close()
+			return fmt.Errorf("%s is used by another process", path)
+		}
+	}
+
+	return os.Remove(path)
+}
+
+// Listener of Unix domain socket: removes the socket on shutdown
+type udsListener struct {
+	syslogd
+	path string
+}
+
+func (ul *udsListener) Kill() error {
+	err := ul.syslogd.Kill()
+
+	if rerr := os.Remove(ul.path); rerr != nil && !errors.Is(rerr, fs.ErrNotExist) && err == nil {
+		err = rerr
+	}
+
+	return err
+}
+
+// Split function for stream Unix domain socket: message ends by LF or NUL.
+// Trailing CR is dropped
+func scanUDSRecords(data []byte, atEOF bool) (int, []byte, error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexAny(data, udsStreamEnds); i >= 0 {
+		token := bytes.TrimSuffix(data[:i], []byte{'\r'})
+		if len(token) == 0 {
+			// Skip empty record, e.g. NUL after LF
+			return i + 1, nil, nil
+		}
+		return i + 1, token, nil
+	}
+
+	if atEOF {
+		return len(data), bytes.TrimSuffix(data, []byte{'\r'}), nil
+	}
+
+	return 0, nil, nil
+}
@@ -0,0 +1,193 @@
+package syslogsidecar
+
+import (
+	"errors"
+	"io/fs"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Creates socket without listener, e.g. after crash of the process
+func staleSocket(t *testing.T, path string) {
+	l, err := net.ListenUnix("unix", &net.UnixAddr{Name: path, Net: "unix"})
+	if err != nil {
+		t.Fatalf("ListenUnix error %v", err)
+	}
+	l.SetUnlinkOnClose(false)
+	l.Close()
+}
+
+func Test_StaleSocket(t *testing.T) {
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "stale.sock")
+	staleSocket(t, path)
+
+	if err := removeStaleSocket(path); err != nil {
+		t.Errorf("stale socket should be removed: %v", err)
+	}
+
+	if _, err := os.Lstat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("stale socket exists")
+	}
+
+	if err := removeStaleSocket(path); err != nil {
+		t.Errorf("missing socket: %v", err)
+	}
+
+	l, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("ListenUnixgram error %v", err)
+	}
+	defer l.Close()
+
+	if err = removeStaleSocket(path); err == nil {
+		t.Errorf("socket in use should not be removed")
+	}
+
+	file := filepath.Join(dir, "file")
+	os.WriteFile(file, nil, 0o644)
+
+	if err = removeStaleSocket(file); err == nil {
+		t.Errorf("regular file should not be removed")
+	}
+}
+
+func Test_UDSAccess(t *testing.T) {
+	access, err := newUDSAccess("0660", "0", "0")
+	if err != nil {
+		t.Fatalf("newUDSAccess error %v", err)
+	}
+
+	if access.mode != 0o660 || access.uid != 0 || access.gid != 0 {
+		t.Errorf("wrong access %+v", access)
+	}
+
+	if access, _ = newUDSAccess("", "", ""); access.mode != 0 || access.uid != -1 || access.gid != -1 {
+		t.Errorf("wrong default access %+v", access)
+	}
+
+	for _, mode := range []string{"rw", "0888", "01777"} {
+		if _, err = newUDSAccess(mode, "", ""); err == nil {
+			t.Errorf("wrong mode %s should fail", mode)
+		}
+	}
+}
+
+func Test_UnixStream(t *testing.T) {
+	for _, tc := range []struct {
+		input    string
+		expected []string
+	}{
+		{"<13>first\x00<13>second\x00", []string{"<13>first", "<13>second"}},
+		{"<13>first\r\n\x00<13>second", []string{"<13>first", "<13>second"}},
+	} {
+		var tokens []string
+		for data := []byte(tc.input); len(data) > 0; {
+			advance, token, _ := scanUDSRecords(data, true)
+			if token != nil {
+				tokens = append(tokens, string(token))
+			}
+			data = data[advance:]
+		}
+
+		if len(tokens) != len(tc.expected) || tokens[0] != tc.expected[0] || tokens[1] != tc.expected[1] {
+			t.Errorf("%q: wrong tokens %q", tc.input, tokens)
+		}
+	}
+
+	path := filepath.Join(t.TempDir(), "log")
+	staleSocket(t, path)
+
+	conf := defaultServerConfiguration()
+	conf.ADDRTCP = ""
+	conf.UDSPATH = path
+	conf.UDS_TYPE = UDSStream
+	conf.UDS_MODE = "0600"
+
+	srv := newServer(conf)
+	if err := srv.initServer(); err != nil {
+		t.Fatalf("Init error %v", err)
+	}
+
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&fs.ModeSocket == 0 || info.Mode().Perm() != 0o600 {
+		t.Errorf("wrong socket %v %v", info, err)
+	}
+
+	if len(srv.streams) != 1 {
+		t.Fatalf("expected stream listener")
+	}
+
+	received := make(logPartsChannel, 2)
+	srv.streams[0].handler = received
+
+	srv.streams[0].Boot()
+
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatalf("Dial error %v", err)
+	}
+
+	// The same as glibc syslog()
+	conn.Write([]byte("<13>Oct 11 22:14:15 app[12]: first\x00<13>Oct 11 22:14:16 app[12]: second\x00"))
+
+	for _, expected := range []string{"first", "second"} {
+		if logParts := <-received; logParts["content"] != expected {
+			t.Errorf("expected %s actual %v", expected, logParts)
+		}
+	}
+
+	conn.Close()
+	srv.stop()
+
+	if _, err = os.Lstat(path); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("socket should be removed on shutdown")
+	}
+}
+
+// Socket appears at the path only with required mode, temporary directory is removed
+func Test_ListenUDS(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "log")
+
+	access, err := newUDSAccess("0640", "", "")
+	if err != nil {
+		t.Fatalf("newUDSAccess error %v", err)
+	}
+
+	srv := newServer(defaultServerConfiguration())
+
+	ls, err := listenUDS(path, access, func(socket string) (syslogd, error) {
+		if socket == path {
+			t.Errorf("socket should be created in temporary directory")
+		}
+		if _, err := os.Lstat(path); !errors.Is(err, fs.ErrNotExist) {
+			t.Errorf("path exists before access settings are applied")
+		}
+		return srv.newsyslogdUnixgram(path, socket)
+	})
+	if err != nil {
+		t.Fatalf("listenUDS error %v", err)
+	}
+
+	ul := &udsListener{syslogd: ls, path: path}
+	defer ul.Kill()
+
+	info, err := os.Lstat(path)
+	if err != nil || info.Mode()&fs.ModeSocket == 0 || info.Mode().Perm() != 0o640 {
+		t.Errorf("wrong socket %v %v", info, err)
+	}
+
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("temporary directory was not removed %v", entries)
+	}
+
+	conn, err := net.Dial("unixgram", path)
+	if err != nil {
+		t.Fatalf("Dial error %v", err)
+	}
+	conn.Close()
+}